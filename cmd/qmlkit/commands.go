@@ -0,0 +1,95 @@
+// commands.go — commands of qmlkit, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"gopkg.in/qml-kit.v0/deploy"
+)
+
+// runners implement the tasks documented in taskDocs.
+var runners = map[string]func(f *flags, args []string) error{
+	"deploy": runDeploy,
+	"clean":  runClean,
+	"doctor": runDoctor,
+}
+
+// interrupt is cancelled on the first interrupt signal.
+var interrupt, _ = signal.NotifyContext(context.Background(), os.Interrupt)
+
+func runDeploy(f *flags, args []string) error {
+	verbose := f.Bool("verbose")
+	cfg, err := deployConfig(f, args)
+	if err != nil {
+		return err
+	}
+	cfg.Events = func(e deploy.Event) {
+		if verbose || e.Level == deploy.Warning {
+			fmt.Fprintln(os.Stderr, e)
+		}
+	}
+	if verbose {
+		cfg.Output = os.Stderr
+	}
+	return deploy.Deploy(cfg)
+}
+
+func runClean(f *flags, args []string) error {
+	cfg, err := deployConfig(f, args)
+	if err != nil {
+		return err
+	}
+	if err = deploy.CleanWizard(cfg); err != nil {
+		return err
+	}
+	return deploy.Clean(cfg, f.Bool("all"))
+}
+
+func runDoctor(f *flags, args []string) error {
+	cfg, err := deployConfig(f, args)
+	if err != nil {
+		return err
+	}
+	if f.Bool("verbose") {
+		cfg.Events = func(e deploy.Event) { fmt.Fprintln(os.Stderr, e) }
+	}
+	if failed := deploy.WriteReport(os.Stdout, deploy.Doctor(cfg)); failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// deployConfig fills the settings shared by commands from their options and
+// the package argument.
+func deployConfig(f *flags, args []string) (cfg deploy.Config, err error) {
+	if cfg, err = deploy.FlagConfig(f, args); err != nil {
+		return cfg, usageError(err.Error())
+	}
+	cfg.Context = interrupt
+	return
+}
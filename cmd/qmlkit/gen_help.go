@@ -0,0 +1,123 @@
+// gen_help.go — generator of help.go, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build ignore
+
+// gen_help.go collects doc comments of the gotask tasks into help.go, so the
+// qmlkit command is documented and parses flags the same way gotask does.
+// Run it with `go generate` after a task or its options are changed.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	taskDir = "../.."
+	outFile = "help.go"
+)
+
+func main() {
+	fset := token.NewFileSet()
+	isTask := func(fi os.FileInfo) bool {
+		return strings.HasSuffix(fi.Name(), "_task.go")
+	}
+	pkgs, err := parser.ParseDir(fset, taskDir, isTask, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	docs := make(map[string]string)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || fn.Doc == nil || !strings.HasPrefix(fn.Name.Name, "Task") {
+					continue
+				}
+				docs[taskName(fn.Name.Name)] = normalize(fn.Doc.Text())
+			}
+		}
+	}
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by gen_help.go from doc comments of *_task.go; DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package main")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "// taskDocs are doc comments of the gotask tasks by task name.")
+	fmt.Fprintln(&buf, "var taskDocs = map[string]string{")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s,\n", strconv.Quote(name), strconv.Quote(docs[name]))
+	}
+	fmt.Fprintln(&buf, "}")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outFile, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// taskName converts a func name the way gotask does: TaskFooBar -> foo-bar.
+func taskName(fn string) string {
+	var name []rune
+	for i, r := range strings.TrimPrefix(fn, "Task") {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name = append(name, '-')
+			}
+			r = unicode.ToLower(r)
+		}
+		name = append(name, r)
+	}
+	return string(name)
+}
+
+// normalize indents lines that are indented with a space instead of a tab.
+func normalize(doc string) string {
+	lines := strings.Split(doc, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, " ") {
+			lines[i] = "\t" + strings.TrimLeft(line, " ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,10 @@
+// Code generated by gen_help.go from doc comments of *_task.go; DO NOT EDIT.
+
+package main
+
+// taskDocs are doc comments of the gotask tasks by task name.
+var taskDocs = map[string]string{
+	"clean":  "NAME\n\tclean - Clean deployment leftovers and wizard configs\n\nDESCRIPTION\n\tRuns `rice clean` to remove leftovers from resource embedding and windows\n\tresource objects, purges wizard configs if any left in project dir.\n\tAn optional argument selects the main package like the deploy task does.\n\nOPTIONS\n\t--all, -a\n\t\tRemove platform specific output dir and staging dirs of failed deployments\n\t--target=<name>\n\t\tTarget the output dir of which is removed, the current platform by default\n",
+	"deploy": "NAME\n\tdeploy - Run platform-specific deployment routine\n\nDESCRIPTION\n\tEmbeds resources, compiles binary, copies related libs and plugins, etc...\n\tDistribution-ready application package will be the result of this task.\n\tSupported platforms are: darwin, linux, windows, more targets may be\n\tregistered with deploy.RegisterTarget.\n\tAn optional argument selects the main package by import path, pattern or dir,\n\tthe package in the current dir is deployed by default.\n\nOPTIONS\n\t--verbose, -v\n\t\tEnable some logging\n\t--target=<name>\n\t\tDeployment target, the current platform by default\n\t--dmg\n\t\tCreate an installable dmg (darwin only)\n\t--rpath\n\t\tRelink binaries against @rpath and add LC_RPATH entries (darwin only)\n\t--universal\n\t\tBuild universal amd64 and arm64 binaries (darwin only)\n\t--version=<version>\n\t\tVersion of the app, overrides the profile and `git describe`\n\t--tags=<tags>\n\t\tBuild tags, comma-separated\n\t--ldflags=<flags>\n\t\tFlags passed to the linker\n\t--gcflags=<flags>\n\t\tFlags passed to the compiler\n\t--trimpath=<bool>\n\t\tRemove file system paths from the executable, true by default\n\t--buildid=<id>\n\t\tBuild id of the executables, empty by default\n\t--race\n\t\tEnable data race detection\n\t--buildenv=<vars>\n\t\tSpace-separated KEY=VALUE pairs added to the environment of go build\n\t--buildargs=<args>\n\t\tExtra arguments of go build\n\t--timeout=<duration>\n\t\tTime limit for each external command, 30m by default\n\t--check\n\t\tDeploy twice and fail if the results differ, no dmg is created,\n\t\tafter-finalize hooks run once the check passes, needs trimpath\n\t--keep-failed\n\t\tKeep the staging dir of a failed deployment for debugging\n",
+	"doctor": "NAME\n\tdoctor - Check the tools and Qt used by deployment\n\nDESCRIPTION\n\tLooks for every external tool the deploy task runs, reports their versions,\n\tmakes sure qmake, qtpaths and pkg-config refer to the same Qt install and that\n\teach lib, plugin and module listed in the profile exists in it.\n\tPrints a pass/warn/fail table with a suggested fix for each problem.\n\tAn optional argument selects the main package like the deploy task does.\n\nOPTIONS\n\t--verbose, -v\n\t\tPrint the commands being run\n\t--target=<name>\n\t\tTarget the profile entries are checked for, the current platform by default\n",
+}
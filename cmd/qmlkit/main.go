@@ -0,0 +1,292 @@
+// main.go — the standalone deployment command, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command qmlkit runs the tasks of the kit without gotask. Commands, their
+// options and help are taken from doc comments of the *_task.go files:
+//
+//     qmlkit deploy -v --dmg
+//     qmlkit deploy ./cmd/helper --target=embedded
+//     qmlkit help deploy
+//
+// It exits with 1 if a command fails, 2 on wrong usage and 130 when interrupted.
+package main
+
+//go:generate go run gen_help.go
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	exitFailure   = 1
+	exitUsage     = 2
+	exitInterrupt = 130
+)
+
+// aliases are alternative names of commands.
+var aliases = map[string]string{
+	"verify": "doctor",
+}
+
+// command is a task parsed from its doc comment.
+type command struct {
+	Name    string
+	Summary string
+	Doc     string
+	Options []option
+	Run     func(f *flags, args []string) error
+}
+
+// option is a flag listed in the OPTIONS section, Value is the placeholder
+// of a string flag and empty for a bool one.
+type option struct {
+	Long  string
+	Short string
+	Value string
+	Usage string
+}
+
+// flags gives access to the parsed options like tasking.T.Flags does.
+type flags struct {
+	bools   map[string]*bool
+	strings map[string]*string
+}
+
+func (f *flags) Bool(name string) bool {
+	if v, ok := f.bools[name]; ok {
+		return *v
+	}
+	return false
+}
+
+func (f *flags) String(name string) string {
+	if v, ok := f.strings[name]; ok {
+		return *v
+	}
+	return ""
+}
+
+// usageError is returned when the command line is wrong.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) < 1 {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	switch name := args[0]; name {
+	case "help", "-h", "-help", "--help":
+		if len(args) < 2 || name != "help" {
+			printUsage(os.Stdout)
+			return 0
+		}
+		cmd, ok := lookup(args[1])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "qmlkit: unknown command %s\n", args[1])
+			return exitUsage
+		}
+		fmt.Fprint(os.Stdout, cmd.Doc)
+		return 0
+	}
+	cmd, ok := lookup(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "qmlkit: unknown command %s\n", args[0])
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	f, rest, err := cmd.parse(args[1:])
+	switch {
+	case err == flag.ErrHelp:
+		fmt.Fprint(os.Stdout, cmd.Doc)
+		return 0
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "qmlkit %s: %v\nrun 'qmlkit help %s' for usage\n", cmd.Name, err, cmd.Name)
+		return exitUsage
+	}
+	if err := cmd.Run(f, rest); err != nil {
+		var usage usageError
+		switch {
+		case errors.As(err, &usage):
+			fmt.Fprintf(os.Stderr, "qmlkit %s: %v\nrun 'qmlkit help %s' for usage\n", cmd.Name, err, cmd.Name)
+			return exitUsage
+		case interrupt.Err() != nil:
+			fmt.Fprintf(os.Stderr, "qmlkit %s: interrupted\n", cmd.Name)
+			return exitInterrupt
+		}
+		fmt.Fprintf(os.Stderr, "qmlkit %s: %v\n", cmd.Name, err)
+		return exitFailure
+	}
+	return 0
+}
+
+// lookup returns the command by its name or alias.
+func lookup(name string) (cmd command, ok bool) {
+	if canonical, ok := aliases[name]; ok {
+		name = canonical
+	}
+	doc, ok := taskDocs[name]
+	if !ok {
+		return
+	}
+	if cmd.Run, ok = runners[name]; !ok {
+		return
+	}
+	cmd.Name, cmd.Doc = name, doc
+	cmd.Summary, cmd.Options = parseDoc(doc)
+	return
+}
+
+func printUsage(w io.Writer) {
+	names := make([]string, 0, len(runners))
+	for name := range runners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Usage: qmlkit <command> [options] [package]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		cmd, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		for alias, canonical := range aliases {
+			if canonical == name {
+				name += ", " + alias
+			}
+		}
+		fmt.Fprintf(w, "    %-16s %s\n", name, cmd.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'qmlkit help <command>' for its options.")
+}
+
+// parseDoc reads the summary from the NAME section and flags from the OPTIONS
+// section of a task doc comment:
+//
+//     NAME
+//         deploy - Run platform-specific deployment routine
+//     OPTIONS
+//         --verbose, -v
+//             Enable some logging
+//         --target=<name>
+//             Deployment target, the current platform by default
+func parseDoc(doc string) (summary string, options []option) {
+	var section string
+	for _, line := range strings.Split(doc, "\n") {
+		text := strings.TrimSpace(line)
+		switch {
+		case len(text) < 1:
+			continue
+		case !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " "):
+			section = text
+			continue
+		}
+		switch section {
+		case "NAME":
+			if i := strings.Index(text, " - "); i >= 0 && len(summary) < 1 {
+				summary = text[i+3:]
+			}
+		case "OPTIONS":
+			if !strings.HasPrefix(text, "-") {
+				if n := len(options); n > 0 && len(options[n-1].Usage) < 1 {
+					options[n-1].Usage = text
+				}
+				continue
+			}
+			var opt option
+			for _, name := range strings.Split(text, ",") {
+				name = strings.TrimSpace(name)
+				if i := strings.Index(name, "="); i >= 0 {
+					name, opt.Value = name[:i], strings.Trim(name[i+1:], "<>")
+				}
+				if strings.HasPrefix(name, "--") {
+					opt.Long = strings.TrimPrefix(name, "--")
+				} else {
+					opt.Short = strings.TrimPrefix(name, "-")
+				}
+			}
+			options = append(options, opt)
+		}
+	}
+	return
+}
+
+// parse parses options of the command, they may be given before and after
+// the positional arguments.
+func (cmd command) parse(args []string) (f *flags, rest []string, err error) {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	f = &flags{
+		bools:   make(map[string]*bool),
+		strings: make(map[string]*string),
+	}
+	for _, opt := range cmd.Options {
+		names := []string{opt.Long}
+		if len(opt.Short) > 0 {
+			names = append(names, opt.Short)
+		}
+		if len(opt.Value) > 0 {
+			v := new(string)
+			for _, name := range names {
+				fs.StringVar(v, name, "", opt.Usage)
+			}
+			f.strings[opt.Long] = v
+			continue
+		}
+		v := new(bool)
+		for _, name := range names {
+			fs.BoolVar(v, name, false, opt.Usage)
+		}
+		f.bools[opt.Long] = v
+	}
+	for {
+		if err = fs.Parse(args); err != nil {
+			return
+		}
+		// Parse drops the "--" it stops at, everything after it is positional
+		if n := len(args) - len(fs.Args()); n > 0 && args[n-1] == "--" {
+			rest = append(rest, fs.Args()...)
+			return
+		}
+		if args = fs.Args(); len(args) < 1 {
+			return
+		}
+		rest, args = append(rest, args[0]), args[1:]
+	}
+}
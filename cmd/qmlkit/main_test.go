@@ -0,0 +1,183 @@
+// main_test.go — tests of the qmlkit command line parsing, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseDoc(t *testing.T) {
+	for name := range runners {
+		if _, ok := taskDocs[name]; !ok {
+			t.Errorf("%s: no doc in help.go, run go generate", name)
+		}
+	}
+	tests := []struct {
+		name    string
+		summary string
+		options []option // a subset of the parsed ones
+	}{
+		{"deploy", "Run platform-specific deployment routine", []option{
+			{Long: "verbose", Short: "v", Usage: "Enable some logging"},
+			{Long: "target", Value: "name", Usage: "Deployment target, the current platform by default"},
+			{Long: "trimpath", Value: "bool", Usage: "Remove file system paths from the executable, true by default"},
+			{Long: "check", Usage: "Deploy twice and fail if the results differ, no dmg is created,"},
+		}},
+		{"clean", "Clean deployment leftovers and wizard configs", []option{
+			{Long: "all", Short: "a", Usage: "Remove platform specific output dir and staging dirs of failed deployments"},
+			{Long: "target", Value: "name", Usage: "Target the output dir of which is removed, the current platform by default"},
+		}},
+		{"doctor", "Check the tools and Qt used by deployment", []option{
+			{Long: "verbose", Short: "v", Usage: "Print the commands being run"},
+		}},
+	}
+	for _, tt := range tests {
+		summary, options := parseDoc(taskDocs[tt.name])
+		if summary != tt.summary {
+			t.Errorf("%s: got summary %q, want %q", tt.name, summary, tt.summary)
+		}
+		for _, want := range tt.options {
+			var found bool
+			for _, opt := range options {
+				if opt.Long == want.Long {
+					found = true
+					if opt != want {
+						t.Errorf("%s: got option %+v, want %+v", tt.name, opt, want)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("%s: no option %s among %+v", tt.name, want.Long, options)
+			}
+		}
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		args    []string
+		bools   map[string]bool
+		strings map[string]string
+		rest    []string
+		err     bool
+	}{
+		{
+			name:    "options around the package",
+			cmd:     "deploy",
+			args:    []string{"-v", "./cmd/app", "--target=linux", "--dmg"},
+			bools:   map[string]bool{"verbose": true, "dmg": true, "check": false},
+			strings: map[string]string{"target": "linux", "version": ""},
+			rest:    []string{"./cmd/app"},
+		},
+		{
+			name:    "long alias and separate value",
+			cmd:     "deploy",
+			args:    []string{"--verbose", "--version", "1.2.3", "--trimpath=false"},
+			bools:   map[string]bool{"verbose": true},
+			strings: map[string]string{"version": "1.2.3", "trimpath": "false"},
+		},
+		{
+			name:    "double dash",
+			cmd:     "clean",
+			args:    []string{"-a", "./app", "--", "--target=x", "-weird"},
+			bools:   map[string]bool{"all": true},
+			rest:    []string{"./app", "--target=x", "-weird"},
+			strings: map[string]string{"target": ""},
+		},
+		{
+			name:  "double dash first",
+			cmd:   "clean",
+			args:  []string{"--", "./app", "-a"},
+			bools: map[string]bool{"all": false},
+			rest:  []string{"./app", "-a"},
+		},
+		{
+			name: "unknown option",
+			cmd:  "doctor",
+			args: []string{"./app", "--dmg"},
+			err:  true,
+		},
+		{
+			name: "string option without value",
+			cmd:  "deploy",
+			args: []string{"--target"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		cmd, ok := lookup(tt.cmd)
+		if !ok {
+			t.Fatalf("%s: no command %s", tt.name, tt.cmd)
+		}
+		f, rest, err := cmd.parse(tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		for name, want := range tt.bools {
+			if got := f.Bool(name); got != want {
+				t.Errorf("%s: got --%s %v, want %v", tt.name, name, got, want)
+			}
+		}
+		for name, want := range tt.strings {
+			if got := f.String(name); got != want {
+				t.Errorf("%s: got --%s %q, want %q", tt.name, name, got, want)
+			}
+		}
+		if !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("%s: got args %q, want %q", tt.name, rest, tt.rest)
+		}
+	}
+	cmd, _ := lookup("deploy")
+	if _, _, err := cmd.parse([]string{"-h"}); err != flag.ErrHelp {
+		t.Errorf("-h: got error %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"bogus"},
+		{"help", "bogus"},
+		{"deploy", "--bogus"},
+		{"doctor", "./a", "./b"},
+	}
+	for _, args := range tests {
+		if code := run(args); code != exitUsage {
+			t.Errorf("%q: got exit code %d, want %d", args, code, exitUsage)
+		}
+	}
+	for _, args := range [][]string{{"help"}, {"help", "verify"}, {"clean", "-h"}} {
+		if code := run(args); code != 0 {
+			t.Errorf("%q: got exit code %d, want 0", args, code)
+		}
+	}
+}
@@ -0,0 +1,2228 @@
+// deploy.go — Go/QML deployment routines, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package deploy builds a Go/QML application and packages it with the Qt libs,
+// plugins and QML modules listed in its deploy_profile.yaml. The gotask tasks
+// of the kit are thin wrappers around it, so deployment may be driven from
+// other tools as well:
+//
+//     err := deploy.Deploy(deploy.Config{Package: "./cmd/app", Dmg: true})
+//
+// Deploy, Clean and Doctor may run at once, though a lock file refuses a second
+// deployment into the same output dir.
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v1"
+)
+
+const (
+	outDir           = "out"
+	relinkBase       = "@executable_path/../Frameworks"
+	rpathBase        = "@rpath"
+	deployProfileSrc = "deploy_profile.yaml"
+)
+
+const (
+	// cmdTimeout is the default limit of the run time of external commands.
+	cmdTimeout = 30 * time.Minute
+	// cmdWaitDelay is how long the output of a killed (or exited) command is waited
+	// for, its children may keep the pipes open long after it is gone.
+	cmdWaitDelay = 5 * time.Second
+)
+
+var (
+	// targetsMu guards deployTargets and hookFuncs, they may be registered while
+	// deployments run.
+	targetsMu sync.RWMutex
+	// deployTargets are the targets Config.Target chooses from, layout rules are used
+	// unless overridden by the profile.
+	deployTargets = map[string]Target{
+		"darwin": {
+			GOOS: "darwin",
+			New:  func() Deployer { return &darwinDeployer{} },
+			Layout: Layout{
+				Root: "{{.App}}.app/Contents",
+				Bin:  "MacOS/{{.Name}}",
+				Libs: LayoutRule{
+					Src: "{{.Qt.LibPath}}/{{.Name}}.framework",
+					Dst: "Frameworks/{{.Name}}.framework",
+				},
+				Extra: LayoutRule{
+					Src: "{{.Qt.LibPath}}/{{.Name}}",
+					Dst: "Frameworks/{{.Name}}",
+				},
+				Plugins: LayoutRule{
+					Src: "{{.Qt.PluginPath}}/{{.Dir}}/libq{{.Name}}.dylib",
+					Dst: "Plugins/{{.Dir}}/libq{{.Name}}.dylib",
+				},
+				PluginFiles: LayoutRule{
+					Src: "{{.Qt.PluginPath}}/{{.Dir}}/{{.Name}}",
+					Dst: "Plugins/{{.Dir}}/{{.Name}}",
+				},
+				Modules: LayoutRule{
+					Src: "{{.Qt.QmlPath}}/{{.Name}}",
+					Dst: "Resources/qml/{{.Name}}",
+				},
+				Qml: LayoutRule{
+					Src: "project/qml",
+					Dst: "Resources/qml",
+				},
+				Translations: LayoutRule{
+					Src: "{{.Qt.TranslationPath}}/{{.Name}}",
+					Dst: "Resources/translations/{{.Name}}",
+				},
+				Conf: "Resources/qt.conf",
+			},
+		},
+		"linux": {
+			GOOS: "linux",
+			New:  func() Deployer { return &linuxDeployer{} },
+			Layout: Layout{
+				Bin: "{{.Name}}",
+				Libs: LayoutRule{
+					Src: "{{.Qt.LibPath}}/libQt{{.Qt.Major}}{{.Short}}.so.{{.Qt.Version}}",
+					Dst: "libQt{{.Qt.Major}}{{.Short}}.so.{{.Qt.Major}}",
+				},
+				Extra: LayoutRule{
+					Src: "{{.Qt.LibPath}}/{{.Name}}",
+					Dst: "{{.Name}}",
+				},
+				Plugins: LayoutRule{
+					Src: "{{.Qt.PluginPath}}/{{.Dir}}/libq{{.Name}}.so",
+					Dst: "{{.Dir}}/libq{{.Name}}.so",
+				},
+				PluginFiles: LayoutRule{
+					Src: "{{.Qt.PluginPath}}/{{.Dir}}/{{.Name}}",
+					Dst: "{{.Dir}}/{{.Name}}",
+				},
+				Modules: LayoutRule{
+					Src: "{{.Qt.QmlPath}}/{{.Name}}",
+					Dst: "qml/{{.Name}}",
+				},
+				Qml: LayoutRule{
+					Src: "project/qml",
+					Dst: "qml",
+				},
+				Translations: LayoutRule{
+					Src: "{{.Qt.TranslationPath}}/{{.Name}}",
+					Dst: "translations/{{.Name}}",
+				},
+				Conf: "qt.conf",
+			},
+		},
+		"windows": {
+			GOOS: "windows",
+			New:  func() Deployer { return &windowsDeployer{} },
+			Layout: Layout{
+				Bin: "{{.Name}}.exe",
+				Libs: LayoutRule{
+					Src: "{{.Qt.BinPath}}/Qt{{.Qt.Major}}{{.Short}}.dll",
+					Dst: "Qt{{.Qt.Major}}{{.Short}}.dll",
+				},
+				Extra: LayoutRule{
+					Src: "{{.Qt.BinPath}}/{{.Name}}",
+					Dst: "{{.Name}}",
+				},
+				Plugins: LayoutRule{
+					Src: "{{.Qt.PluginPath}}/{{.Dir}}/q{{.Name}}.dll",
+					Dst: "{{.Dir}}/q{{.Name}}.dll",
+				},
+				PluginFiles: LayoutRule{
+					Src: "{{.Qt.PluginPath}}/{{.Dir}}/{{.Name}}",
+					Dst: "{{.Dir}}/{{.Name}}",
+				},
+				Modules: LayoutRule{
+					Src: "{{.Qt.QmlPath}}/{{.Name}}",
+					Dst: "qml/{{.Name}}",
+				},
+				Qml: LayoutRule{
+					Src: "project/qml",
+					Dst: "qml",
+				},
+				Translations: LayoutRule{
+					Src: "{{.Qt.TranslationPath}}/{{.Name}}",
+					Dst: "translations/{{.Name}}",
+				},
+				Conf: "qt.conf",
+			},
+		},
+	}
+)
+
+type config struct {
+	*runner
+	PkgInfo   pkgInfo // of the primary binary
+	Binaries  []binaryInfo
+	QtInfo    qtInfo
+	Release   releaseInfo
+	Profile   deployProfile
+	Path      string // the package is deployed into, a staging dir
+	FinalPath string // the package is moved to on success
+	Dmg       bool
+}
+
+type deployProfile struct {
+	Version      string
+	Build        BuildOptions
+	Hooks        map[string][]hookProfile
+	Binaries     []binaryProfile
+	Qmake        string
+	QtDir        string
+	Rpath        bool
+	Universal    bool
+	Icon         string
+	Libs         map[string][]string
+	Plugins      map[string]map[string][]string
+	Platforms    map[string][]string // alias for plugins/<target>/platforms
+	Modules      map[string][]string
+	Imageformats []string // alias for plugins/default/imageformats
+	Extra        map[string][]string
+	Bundle       bundleProfile
+	Windows      windowsProfile
+	Desktop      desktopProfile
+	Translations []string
+	QtConf       map[string]map[string]map[string]string
+	Layout       map[string]Layout
+}
+
+// Layout describes where things come from and where they go for a target.
+// Templates are expanded with layoutVars, destinations are relative to the Root
+// of the package and use slash as a separator.
+type Layout struct {
+	Root         string
+	Bin          string // location of executables, .Name is the binary
+	Libs         LayoutRule
+	Extra        LayoutRule
+	Plugins      LayoutRule
+	PluginFiles  LayoutRule // plugins listed by file name, i.e. libcupsprintersupport.so
+	Modules      LayoutRule
+	Qml          LayoutRule
+	Translations LayoutRule
+	Conf         string // location of qt.conf
+}
+
+type LayoutRule struct {
+	Src, Dst string
+}
+
+// layoutVars is the data layout templates are executed with. Name is the entry
+// as listed in the profile, i.e. QtCore, and Short is the same without Qt prefix.
+// For plugins Dir is the category, for modules Name is the path within qml dir.
+type layoutVars struct {
+	App, Name, Short, Dir string
+	Qt                    qtInfo
+	Release               releaseInfo
+}
+
+type qtInfo struct {
+	Version         string
+	Major           string
+	Qmake           string
+	BasePath        string
+	LibPath         string
+	PluginPath      string
+	QmlPath         string
+	BinPath         string
+	TranslationPath string
+	HeaderPath      string
+}
+
+// BuildOptions tunes the `go build` invocation used to compile the app.
+type BuildOptions struct {
+	Tags     []string
+	Ldflags  string
+	Gcflags  string
+	Trimpath *bool  // nil means true, reproducible builds need -trimpath
+	Buildid  string // build id of binaries, empty by default
+	Race     bool
+	Env      map[string]string
+	Args     []string
+}
+
+// trimpath tells whether -trimpath is passed to go build.
+func (b BuildOptions) trimpath() bool {
+	return b.Trimpath == nil || *b.Trimpath
+}
+
+// bundleProfile describes the darwin application bundle, it is used to generate
+// Info.plist. Identifier defaults to the reversed import path.
+type bundleProfile struct {
+	Identifier           string
+	Name                 string
+	DisplayName          string
+	Version              string // CFBundleShortVersionString
+	Build                string // CFBundleVersion
+	MinimumSystemVersion string
+	HighResolution       *bool
+	DocumentTypes        []bundleDocumentType
+	URLSchemes           []bundleURLScheme
+	Extra                map[string]interface{}
+}
+
+type bundleDocumentType struct {
+	Name       string
+	Role       string
+	Extensions []string
+	Types      []string // UTIs
+	Icon       string
+}
+
+type bundleURLScheme struct {
+	Name    string
+	Schemes []string
+}
+
+// releaseInfo is stamped into the binary and generated metadata, Date is
+// Time formatted as RFC 3339.
+type releaseInfo struct {
+	Version, Commit, Date string
+	Time                  time.Time
+}
+
+// pkgInfo describes the main package being deployed. Root is the module root
+// (the package dir in GOPATH mode), Base is the dir holding project assets,
+// relative paths of the profile are resolved against it.
+type pkgInfo struct {
+	Name, ImportPath, Dir string
+	Root, Base            string
+}
+
+// binaryProfile declares an executable of the package. Package is an import path
+// or a dir (relative ones are resolved like other paths of the profile), Name
+// defaults to the last element of the import path.
+type binaryProfile struct {
+	Package string
+	Name    string
+	Primary bool
+}
+
+// binaryInfo is a resolved binaryProfile, Pkg.Name is the output name.
+type binaryInfo struct {
+	Pkg     pkgInfo
+	Primary bool
+}
+
+// Config describes a deployment, zero values stand for defaults.
+type Config struct {
+	Package string // import path, pattern or dir of the main package, "." by default
+	Target  string // registered target, the current platform by default
+	Profile string // deploy_profile.yaml of the project dir by default
+	OutDir  string // "out" of the project dir by default, the package is put into OutDir/Target
+	Version string // overrides the profile and `git describe`
+	Build   BuildOptions
+
+	Dmg        bool // create an installable dmg (darwin only)
+	Rpath      bool // relink against @rpath (darwin only)
+	Universal  bool // build amd64 and arm64 universal binaries (darwin only)
+	Check      bool // deploy twice and compare the results, no dmg is created, see checkDeploy
+	KeepFailed bool // keep the staging dir of a failed deployment for debugging
+
+	Timeout time.Duration   // limit for each external command, 30m by default
+	Context context.Context // cancels the deployment, i.e. on interrupt
+	Events  func(Event)     // receives progress, may be nil
+	Output  io.Writer       // receives output of external commands, may be nil
+}
+
+// Level tells how important an event is.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warning
+)
+
+// Event reports progress of a deployment. Target and Stage are empty for events
+// not related to them.
+type Event struct {
+	Level  Level
+	Target string
+	Stage  string
+	Msg    string
+}
+
+func (e Event) String() string {
+	prefix := "deploy:"
+	if len(e.Target) > 0 {
+		prefix = fmt.Sprintf("deploy [%s]:", e.Target)
+	}
+	if e.Level == Warning {
+		prefix += " warning:"
+	}
+	return prefix + " " + e.Msg
+}
+
+// runner runs external commands and reports progress for a single call of Deploy,
+// Clean or Doctor, so calls with different settings may run at once.
+type runner struct {
+	ctx       context.Context // cancels commands being run
+	timeout   time.Duration   // limits their run time
+	waitDelay time.Duration   // see cmdWaitDelay
+	output    io.Writer       // receives their output, may be nil
+	events    func(Event)     // receives progress, may be nil
+	cgoOnce   sync.Once
+	cgoFlags  [2]string // CGO_CXXFLAGS and CGO_LDFLAGS, see goCgoFlags
+}
+
+func newRunner(cfg *Config) *runner {
+	r := &runner{
+		ctx:       cfg.Context,
+		timeout:   cfg.Timeout,
+		waitDelay: cmdWaitDelay,
+		output:    cfg.Output,
+		events:    cfg.Events,
+	}
+	if r.ctx == nil {
+		r.ctx = context.Background()
+	}
+	if r.timeout <= 0 {
+		r.timeout = cmdTimeout
+	}
+	return r
+}
+
+// emit sends an event to the sink of the call, if any.
+func (r *runner) emit(e Event) {
+	if r.events != nil {
+		r.events(e)
+	}
+}
+
+func (r *runner) debugf(format string, args ...interface{}) {
+	r.emit(Event{Level: Debug, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Deploy embeds resources, compiles binaries, copies related libs and plugins, etc...
+// A distribution-ready application package in cfg.OutDir is the result.
+// The package is deployed into a staging dir next to it and replaces the
+// previous one only on success, the staging dir is removed if deployment
+// fails unless cfg.KeepFailed is set.
+func Deploy(cfg Config) (err error) {
+	r := newRunner(&cfg)
+	target, err := getTarget(cfg.Target)
+	if err != nil {
+		return
+	}
+	// gather info
+	pkgInfo, err := getPkgInfo(r, cfg.pkg())
+	if err != nil {
+		return
+	}
+	// prepare output path
+	path := filepath.Join(cfg.outDir(pkgInfo), target)
+	unlock, err := lockOutput(path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	staging := siblingPath(path, stagingSuffix)
+	// read deploy profile
+	profile, err := readProfile(cfg.profile(pkgInfo))
+	if err != nil {
+		return
+	}
+	r.debugf("profile loaded")
+	if len(profile.Icon) > 0 {
+		profile.Icon = pkgInfo.path(profile.Icon)
+	}
+	binaries, err := getBinaries(r, pkgInfo, &profile)
+	if err != nil {
+		return
+	}
+	if err = checkHooks(&profile); err != nil {
+		return
+	}
+	qtInfo, err := getQtInfo(r, &profile)
+	if err != nil {
+		return
+	}
+	profile.Build.override(cfg.Build)
+	profile.Rpath = profile.Rpath || cfg.Rpath
+	profile.Universal = profile.Universal || cfg.Universal
+	if cfg.Check && !profile.Build.trimpath() {
+		err = fmt.Errorf("deploy: check: binaries built without -trimpath differ, enable trimpath")
+		return
+	}
+	release, err := getReleaseInfo(r, pkgInfo, cfg.Version, &profile)
+	if err != nil {
+		return
+	}
+	c := &config{
+		runner:    r,
+		PkgInfo:   primaryBinary(binaries).Pkg,
+		Binaries:  binaries,
+		QtInfo:    qtInfo,
+		Release:   release,
+		Path:      staging,
+		FinalPath: path,
+		Profile:   profile,
+		Dmg:       cfg.Dmg,
+	}
+	r.debugf("package name: %s", c.PkgInfo.Name)
+	for _, bin := range binaries {
+		r.debugf("binary: %s (%s)", bin.Pkg.Name, bin.Pkg.ImportPath)
+	}
+	r.debugf("version: %s (%s)", release.Version, release.Commit)
+	r.debugf("qt base: %s (%s)", qtInfo.BasePath, qtInfo.Version)
+	r.debugf("qmake: %s", qtInfo.Qmake)
+	if cfg.Check && c.Dmg {
+		r.emit(Event{Level: Warning, Msg: "check: disk images are not reproducible, skipping dmg"})
+		c.Dmg = false
+	}
+	// a staging dir may be left by a failed deployment
+	if err = os.RemoveAll(staging); err != nil {
+		return
+	}
+	if err = os.MkdirAll(staging, 0755); err != nil {
+		return
+	}
+
+	finish, err := deploy(c, target)
+	if err == nil && cfg.Check {
+		err = checkDeploy(c, target, siblingPath(path, checkSuffix))
+	}
+	if err == nil {
+		err = finish()
+	}
+	// clean leftovers
+	for _, bin := range binaries {
+		if _, cerr := r.run(riceCmd(bin.Pkg, "clean")); cerr != nil && err == nil {
+			err = fmt.Errorf("clean: rice: %v", cerr)
+		}
+	}
+	if err != nil {
+		if cfg.KeepFailed {
+			r.emit(Event{Level: Warning, Msg: "staging dir kept: " + staging})
+		} else if rerr := os.RemoveAll(staging); rerr != nil {
+			return fmt.Errorf("%v (cleanup: %v)", err, rerr)
+		}
+		return
+	}
+	return replaceDir(staging, path)
+}
+
+// deploy runs hooks, embeds resources and runs the deployer of target up to the
+// after-finalize hooks, finish runs them and packages the result.
+func deploy(cfg *config, target string) (finish func() error, err error) {
+	if err = runHooks(cfg, target, stageBeforeBuild); err != nil {
+		return
+	}
+	// embed resources
+	cfg.debugf("embedding resources")
+	for _, bin := range cfg.Binaries {
+		if _, err = cfg.run(riceCmd(bin.Pkg, "embed-go")); err != nil {
+			return nil, fmt.Errorf("rice: %v", err)
+		}
+	}
+	// run deployment
+	job, err := newJob(cfg, target)
+	if err != nil {
+		return
+	}
+	t, _ := LookupTarget(target)
+	return runDeployer(t.New(), job)
+}
+
+// Clean runs `rice clean` to remove leftovers from resource embedding and removes
+// windows resource objects, with all the output dir of the target is removed too
+// along with staging dirs left by failed deployments.
+func Clean(cfg Config, all bool) (err error) {
+	r := newRunner(&cfg)
+	pkgInfo, err := getPkgInfo(r, cfg.pkg())
+	if err != nil {
+		return
+	}
+	bins := []binaryInfo{{Pkg: pkgInfo, Primary: true}}
+	if profile, err := readProfile(cfg.profile(pkgInfo)); err == nil {
+		if bins, err = getBinaries(r, pkgInfo, &profile); err != nil {
+			return err
+		}
+	}
+	for _, bin := range bins {
+		if _, err = r.run(riceCmd(bin.Pkg, "clean")); err != nil {
+			return fmt.Errorf("rice: %v", err)
+		}
+		// resources left by an interrupted windows deploy
+		sysos, _ := filepath.Glob(filepath.Join(bin.Pkg.Dir, fmt.Sprintf(sysoNameFormat, "*")))
+		for _, name := range sysos {
+			if err = os.Remove(name); err != nil {
+				return
+			}
+		}
+	}
+	if !all {
+		return
+	}
+	target, err := getTarget(cfg.Target)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(cfg.outDir(pkgInfo), target)
+	unlock, err := lockOutput(path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	for _, dir := range []string{
+		path, siblingPath(path, stagingSuffix), siblingPath(path, checkSuffix), siblingPath(path, oldSuffix),
+	} {
+		if err = os.RemoveAll(dir); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *Config) pkg() string {
+	if len(c.Package) < 1 {
+		return "."
+	}
+	return c.Package
+}
+
+// profile returns the profile path, the default one is looked up in the project
+// dir of pkg rather than the current one.
+func (c *Config) profile(pkg pkgInfo) string {
+	if len(c.Profile) < 1 {
+		return pkg.path(deployProfileSrc)
+	}
+	return c.Profile
+}
+
+// outDir returns the output dir, the default one is put into the project dir of pkg.
+func (c *Config) outDir(pkg pkgInfo) string {
+	if len(c.OutDir) < 1 {
+		return pkg.path(outDir)
+	}
+	return c.OutDir
+}
+
+// darwinDeployer is a routine for Darwin (OS X)
+type darwinDeployer struct {
+	BaseDeployer
+	rpath     bool
+	universal bool
+	base      string // install name prefix of frameworks
+	fwDir     string
+}
+
+// Layout creates the bundle structure along with Info.plist and the icon.
+func (d *darwinDeployer) Layout(job *Job) (err error) {
+	cfg := job.cfg
+	if err = d.BaseDeployer.Layout(job); err != nil {
+		return
+	}
+	// target.app/Contents/{MacOS,Frameworks,Plugins,Resources}
+	for _, dir := range []string{"MacOS", "Frameworks", "Plugins", "Resources"} {
+		if err = os.MkdirAll(filepath.Join(job.Root, dir), 0755); err != nil {
+			return
+		}
+	}
+	// target.app/Resources/target.icns
+	var icon string
+	if len(cfg.Profile.Icon) > 0 {
+		job.Log("rendering icon")
+		icon = cfg.PkgInfo.Name + ".icns"
+		if err = writeIcnsFile(filepath.Join(job.Root, "Resources", icon), cfg.Profile.Icon); err != nil {
+			return
+		}
+	}
+	// target.app/Info.plist
+	if err = writeInfoPlist(job.Root, cfg, icon); err != nil {
+		return
+	}
+	// target.app/PkgInfo
+	err = ioutil.WriteFile(filepath.Join(job.Root, "PkgInfo"), []byte("APPL????\n"), 0666)
+	if err != nil {
+		return
+	}
+	// target.app/Resources/empty.lproj
+	err = ioutil.WriteFile(filepath.Join(job.Root, "Resources", "empty.lproj"), nil, 0666)
+	if err != nil {
+		return
+	}
+
+	// with --rpath install names are rewritten to @rpath/... and each binary gets
+	// LC_RPATH pointing to Frameworks relative to its own location.
+	d.rpath = cfg.Profile.Rpath
+	d.universal = cfg.Profile.Universal
+	d.base = relinkBase
+	if d.rpath {
+		d.base = rpathBase
+	}
+	fwDir, err := job.Layout.dir(job.Layout.Libs.Dst, job.vars())
+	if err != nil {
+		return
+	}
+	d.fwDir = filepath.Join(job.Root, fwDir)
+	job.Fixup = func(name string) error {
+		return d.relink(job, name)
+	}
+	return
+}
+
+// Build builds binaries (universal ones if asked) into MacOS and relinks them.
+func (d *darwinDeployer) Build(job *Job) (err error) {
+	cfg := job.cfg
+	for _, bin := range cfg.Binaries {
+		job.Log("building executable ", bin.Pkg.Name)
+		name, err := job.BinPath(bin.Pkg.Name)
+		if err != nil {
+			return err
+		}
+		if d.universal {
+			err = goBuildUniversal(cfg, bin.Pkg, name)
+		} else {
+			err = goBuild(cfg, bin.Pkg, name)
+		}
+		if err != nil {
+			return err
+		}
+		// helpers may not link Qt at all, only the primary binary must
+		strict := bin.Primary
+		if linked, err := readLinkedQt(name); err == nil && len(linked.Lib) > 0 {
+			strict = true
+		}
+		if err = darwinRelink(cfg.runner, cfg.QtInfo.LibPath, name, d.base, strict); err != nil {
+			return err
+		}
+		if d.rpath {
+			if err = darwinAddRpath(cfg.runner, name, loaderRpath(name, d.fwDir)); err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+// relink relinks any Mach-O binary copied into the bundle, for universal builds
+// frameworks must have all slices while plugins may lack some.
+func (d *darwinDeployer) relink(job *Job, name string) error {
+	if !isMachO(name) {
+		return nil
+	}
+	if d.universal {
+		missing, err := missingSlices(name, universalArches)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			msg := fmt.Sprintf("%s has no %s slice", name, strings.Join(missing, ", "))
+			if strings.Contains(filepath.ToSlash(name), ".framework/") {
+				return fmt.Errorf("deploy [%s]: %s", job.Target, msg)
+			}
+			job.Warn(msg)
+		}
+	}
+	if err := darwinRelink(job.cfg.runner, job.cfg.QtInfo.LibPath, name, d.base, false); err != nil {
+		return err
+	}
+	if !d.rpath {
+		return nil
+	}
+	if strings.Contains(filepath.ToSlash(name), ".framework/") {
+		id, err := filepath.Rel(d.fwDir, name)
+		if err != nil {
+			return err
+		}
+		return darwinSetID(job.cfg.runner, name, rpathBase+"/"+filepath.ToSlash(id))
+	}
+	return darwinAddRpath(job.cfg.runner, name, loaderRpath(name, d.fwDir))
+}
+
+// Package creates an installable disk image if --dmg is set.
+func (d *darwinDeployer) Package(job *Job) (err error) {
+	cfg := job.cfg
+	if !cfg.Dmg {
+		return
+	}
+	job.Log("creating disk image")
+	err = os.Symlink("/Applications", filepath.Join(cfg.Path, "Applications"))
+	if err != nil {
+		return
+	}
+	dmg := filepath.Join(cfg.Path, cfg.Release.fileName(cfg.PkgInfo.Name)+".dmg")
+	// the volume is named after the output dir, not the staging one
+	cmd := exec.Command("hdiutil", "create", "-volname", job.Target, "-srcfolder", cfg.Path, dmg)
+	if _, err = cfg.run(cmd); err != nil {
+		return
+	}
+	return os.Chtimes(dmg, cfg.Release.Time, cfg.Release.Time)
+}
+
+// linuxDeployer is a routine for Linux
+type linuxDeployer struct {
+	BaseDeployer
+}
+
+// Build builds binaries along with .sh launchers setting LD_LIBRARY_PATH.
+func (d *linuxDeployer) Build(job *Job) (err error) {
+	if err = d.BaseDeployer.Build(job); err != nil {
+		return
+	}
+	for _, bin := range job.cfg.Binaries {
+		name, err := job.BinPath(bin.Pkg.Name)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(name+".sh", []byte(shRun), 0755); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// Finalize writes qt.conf and freedesktop integration files.
+func (d *linuxDeployer) Finalize(job *Job) (err error) {
+	if err = d.BaseDeployer.Finalize(job); err != nil {
+		return
+	}
+	job.Log("desktop integration")
+	name, err := job.BinPath(job.cfg.PkgInfo.Name)
+	if err != nil {
+		return
+	}
+	launcher, err := filepath.Rel(job.cfg.Path, name+".sh")
+	if err != nil {
+		return
+	}
+	return writeDesktopFiles(job.cfg, job.cfg.Path, launcher)
+}
+
+// windowsDeployer is a routine for Windows
+type windowsDeployer struct {
+	BaseDeployer
+}
+
+// Build builds binaries, icon, version info and manifest of each are linked in
+// from a .syso object.
+func (d *windowsDeployer) Build(job *Job) (err error) {
+	cfg := job.cfg
+	goarch := buildArch(cfg)
+	build := func(bin binaryInfo) error {
+		name, err := job.BinPath(bin.Pkg.Name)
+		if err != nil {
+			return err
+		}
+		syso, err := writeWinSyso(bin.Pkg, goarch, cfg)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(syso)
+		return goBuild(cfg, bin.Pkg, name)
+	}
+	for _, bin := range cfg.Binaries {
+		job.Log("building executable ", bin.Pkg.Name)
+		if err = build(bin); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// PlanFile is a single file or tree the package layout takes from the Qt install
+// or the project.
+type PlanFile struct {
+	Kind string // libs, extra, plugins, qml, modules or translations
+	Name string
+	Src  string
+	Dst  string // relative to the layout root
+	Tree bool
+}
+
+// Plan lists what deployers are going to copy for target, so the
+// same list may be checked without touching the package.
+type Plan struct {
+	Root  string
+	Dirs  []string // plugin category dirs, created even if empty
+	Files []PlanFile
+}
+
+// planLayout expands layout rules of target for every entry of the profile.
+func planLayout(cfg *config, target string) (plan Plan, err error) {
+	layout := cfg.Profile.layout(target)
+	vars := layoutVars{
+		App:     cfg.PkgInfo.Name,
+		Qt:      cfg.QtInfo,
+		Release: cfg.Release,
+	}
+	if plan.Root, err = layout.expand(layout.Root, vars); err != nil {
+		return
+	}
+
+	add := func(kind string, rule LayoutRule, name, dir string, tree bool) (err error) {
+		vars := vars
+		vars.Name = name
+		if !tree {
+			vars.Short = strings.TrimPrefix(name, "Qt")
+			vars.Dir = dir
+		}
+		f := PlanFile{Kind: kind, Name: name, Tree: tree}
+		if f.Src, err = layout.expand(rule.Src, vars); err != nil {
+			return
+		}
+		f.Src = cfg.PkgInfo.path(f.Src)
+		if f.Dst, err = layout.expand(rule.Dst, vars); err != nil {
+			return
+		}
+		plan.Files = append(plan.Files, f)
+		return
+	}
+
+	libs := append([]string{}, cfg.Profile.Libs["default"]...)
+	libs = append(libs, targetList(cfg.Profile.Libs, target)...)
+	for _, lib := range libs {
+		if err = add("libs", layout.Libs, lib, "", false); err != nil {
+			return
+		}
+	}
+	for _, lib := range targetList(cfg.Profile.Extra, target) {
+		if err = add("extra", layout.Extra, lib, "", false); err != nil {
+			return
+		}
+	}
+
+	plugins := cfg.Profile.plugins(target)
+	for _, dir := range sortedKeys(plugins) {
+		vars := vars
+		vars.Dir = dir
+		targ, err := layout.expand(layout.Plugins.Dst, vars)
+		if err != nil {
+			return plan, err
+		}
+		plan.Dirs = append(plan.Dirs, filepath.Dir(targ))
+		for _, name := range plugins[dir] {
+			rule := layout.Plugins
+			if len(filepath.Ext(name)) > 0 {
+				rule = layout.PluginFiles
+			}
+			if err = add("plugins", rule, name, dir, false); err != nil {
+				return plan, err
+			}
+		}
+	}
+
+	if err = add("qml", layout.Qml, "", "", true); err != nil {
+		return
+	}
+	categories := make([]string, 0, len(cfg.Profile.Modules))
+	for category := range cfg.Profile.Modules {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		parts := strings.Split(category, "/")
+		if parts[0] != "qml" {
+			return plan, fmt.Errorf("deploy: modules: not a qml category: %s", category)
+		}
+		for _, name := range cfg.Profile.Modules[category] {
+			name = strings.Join(append(parts[1:], name), "/")
+			if err = add("modules", layout.Modules, cfg.QtInfo.moduleName(name), "", true); err != nil {
+				return
+			}
+		}
+	}
+
+	plan.Files = dropNested(plan.Files, "modules")
+
+	for _, name := range cfg.Profile.Translations {
+		if err = add("translations", layout.Translations, name, "", false); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// dropNested removes trees of kind that lie within another tree of the same kind,
+// i.e. QtQuick/Controls when the whole QtQuick is copied (QtQuick.2 turns into
+// QtQuick with Qt 6), so nothing is copied twice.
+func dropNested(files []PlanFile, kind string) []PlanFile {
+	within := func(f PlanFile) bool {
+		dst := filepath.ToSlash(filepath.Clean(f.Dst))
+		for _, other := range files {
+			if other.Kind != kind || !other.Tree || other == f {
+				continue
+			}
+			parent := filepath.ToSlash(filepath.Clean(other.Dst))
+			if strings.HasPrefix(dst, parent+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	var kept []PlanFile
+	for i, f := range files {
+		if f.Kind == kind && f.Tree && (within(f) || hasFile(files[:i], f)) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+func hasFile(files []PlanFile, f PlanFile) bool {
+	for _, other := range files {
+		if other == f {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyFiles copies files of the plan of given kinds into the package, the
+// Fixup func (if any) is called for every file copied, e.g. to relink it.
+func (job *Job) CopyFiles(kinds ...string) (err error) {
+	for _, f := range job.Plan.Files {
+		if !hasString(kinds, f.Kind) {
+			continue
+		}
+		targ := filepath.Join(job.Root, f.Dst)
+		if err = os.MkdirAll(filepath.Dir(targ), 0755); err != nil {
+			return
+		}
+		switch {
+		case f.Tree:
+			err = copyTree(f.Src, targ)
+		case filepath.Ext(f.Src) == ".framework":
+			targ, err = copyFramework(f.Src, targ, job.cfg.QtInfo)
+		default:
+			err = copyFile(f.Src, targ)
+		}
+		if err != nil {
+			return
+		}
+		if job.Fixup == nil {
+			continue
+		}
+		if !f.Tree {
+			if err = job.Fixup(targ); err != nil {
+				return
+			}
+			continue
+		}
+		err = filepath.Walk(targ, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				return job.Fixup(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// writeQtConf generates qt.conf for the package, paths are derived from layout rules
+// so they point to the dirs files were actually copied to. Profile may add extra keys
+// and sections, the [Platforms] one for example.
+func writeQtConf(cfg *config, target string, layout Layout, root string) (err error) {
+	vars := layoutVars{
+		App:     cfg.PkgInfo.Name,
+		Qt:      cfg.QtInfo,
+		Release: cfg.Release,
+	}
+	name, err := layout.expand(layout.Conf, vars)
+	if err != nil {
+		return
+	}
+	paths := map[string]string{
+		"Prefix": ".",
+	}
+	for key, rule := range map[string]LayoutRule{
+		"Plugins":      layout.Plugins,
+		"Imports":      layout.Modules,
+		"Qml2Imports":  layout.Modules,
+		"Libraries":    layout.Libs,
+		"Translations": layout.Translations,
+	} {
+		if paths[key], err = layout.dir(rule.Dst, vars); err != nil {
+			return
+		}
+	}
+	sections := map[string]map[string]string{
+		"Paths": paths,
+	}
+	for _, conf := range []map[string]map[string]string{
+		cfg.Profile.QtConf["default"], cfg.Profile.QtConf[section(target, func(key string) bool {
+			_, ok := cfg.Profile.QtConf[key]
+			return ok
+		})],
+	} {
+		for section, keys := range conf {
+			if sections[section] == nil {
+				sections[section] = make(map[string]string)
+			}
+			for key, val := range keys {
+				sections[section][key] = val
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	names := make([]string, 0, len(sections))
+	for section := range sections {
+		if section != "Paths" {
+			names = append(names, section)
+		}
+	}
+	sort.Strings(names)
+	for i, section := range append([]string{"Paths"}, names...) {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", section)
+		keys := make([]string, 0, len(sections[section]))
+		for key := range sections[section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "%s = %s\n", key, sections[section][key])
+		}
+	}
+	name = filepath.Join(root, name)
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return
+	}
+	return ioutil.WriteFile(name, buf.Bytes(), 0666)
+}
+
+// section returns the key a per-target section of the profile is looked up by:
+// the target name if has reports such a section, the GOOS of the target otherwise,
+// so a target registered for a platform (i.e. embedded on linux) gets its entries.
+func section(target string, has func(key string) bool) string {
+	if has(target) {
+		return target
+	}
+	if t, ok := LookupTarget(target); ok && len(t.GOOS) > 0 {
+		return t.GOOS
+	}
+	return target
+}
+
+// targetList returns the section of target from a profile map of lists.
+func targetList(m map[string][]string, target string) []string {
+	return m[section(target, func(key string) bool {
+		_, ok := m[key]
+		return ok
+	})]
+}
+
+// layout returns the layout rules for target, rules set in the profile
+// take precedence over the default ones.
+func (p *deployProfile) layout(target string) Layout {
+	t, _ := LookupTarget(target)
+	layout := t.Layout
+	custom, ok := p.Layout[target]
+	if !ok {
+		return layout
+	}
+	if len(custom.Root) > 0 {
+		layout.Root = custom.Root
+	}
+	if len(custom.Bin) > 0 {
+		layout.Bin = custom.Bin
+	}
+	layout.Libs = layout.Libs.merge(custom.Libs)
+	layout.Extra = layout.Extra.merge(custom.Extra)
+	layout.Plugins = layout.Plugins.merge(custom.Plugins)
+	layout.PluginFiles = layout.PluginFiles.merge(custom.PluginFiles)
+	layout.Modules = layout.Modules.merge(custom.Modules)
+	layout.Qml = layout.Qml.merge(custom.Qml)
+	layout.Translations = layout.Translations.merge(custom.Translations)
+	if len(custom.Conf) > 0 {
+		layout.Conf = custom.Conf
+	}
+	return layout
+}
+
+func (r LayoutRule) merge(custom LayoutRule) LayoutRule {
+	if len(custom.Src) > 0 {
+		r.Src = custom.Src
+	}
+	if len(custom.Dst) > 0 {
+		r.Dst = custom.Dst
+	}
+	return r
+}
+
+// expand executes the layout template tpl and returns a native path.
+func (l Layout) expand(tpl string, vars layoutVars) (string, error) {
+	tmpl, err := template.New("layout").Parse(tpl)
+	if err != nil {
+		return "", fmt.Errorf("layout: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("layout: %v", err)
+	}
+	return filepath.FromSlash(buf.String()), nil
+}
+
+// plugins returns Qt plugins to deploy for target grouped by category.
+// Entries of the default section go first, the legacy platforms and imageformats keys
+// are merged in as well.
+func (p *deployProfile) plugins(target string) map[string][]string {
+	plugins := make(map[string][]string)
+	seen := make(map[string]bool)
+	add := func(dir string, names []string) {
+		if _, ok := plugins[dir]; !ok {
+			plugins[dir] = []string{}
+		}
+		for _, name := range names {
+			if seen[dir+"/"+name] {
+				continue
+			}
+			seen[dir+"/"+name] = true
+			plugins[dir] = append(plugins[dir], name)
+		}
+	}
+	sections := []string{"default", section(target, func(key string) bool {
+		_, ok := p.Plugins[key]
+		return ok
+	})}
+	for _, section := range sections {
+		for _, dir := range sortedKeys(p.Plugins[section]) {
+			add(dir, p.Plugins[section][dir])
+		}
+	}
+	if names, ok := p.Platforms[section(target, func(key string) bool {
+		_, ok := p.Platforms[key]
+		return ok
+	})]; ok {
+		add("platforms", names)
+	}
+	if p.Imageformats != nil {
+		add("imageformats", p.Imageformats)
+	}
+	return plugins
+}
+
+// dir returns a slash-separated dir of the destination template relative to the root,
+// path elements depending on the name of entry or its category are cut off, so
+// Frameworks/{{.Name}}.framework/Versions/5/{{.Name}} gives Frameworks.
+func (l Layout) dir(tpl string, vars layoutVars) (string, error) {
+	const mark = "\x00"
+	vars.Name, vars.Short, vars.Dir = mark, mark, mark
+	path, err := l.expand(tpl, vars)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i, part := range parts {
+		if strings.Contains(part, mark) {
+			parts = parts[:i]
+			break
+		}
+	}
+	if len(parts) < 1 {
+		return ".", nil
+	}
+	return filepath.ToSlash(filepath.Clean(strings.Join(parts, "/"))), nil
+}
+
+// getQtInfo detects the Qt installation to deploy with. The qmake binary is chosen
+// from (in order of precedence) $QMLKIT_QMAKE, $QMLKIT_QT_DIR/bin, the qmake and qtdir
+// keys of the profile and finally $PATH, where qmake6 and qtpaths6 are tried as well.
+// Paths are obtained by parsing `qmake -query` (or `qtpaths6 --query`):
+//
+//     QT_VERSION:5.3.0
+//     QT_INSTALL_LIBS:/usr/local/Cellar/qt5/5.3.0/lib
+//     QT_INSTALL_PLUGINS:/usr/local/Cellar/qt5/5.3.0/plugins
+func getQtInfo(r *runner, profile *deployProfile) (info qtInfo, err error) {
+	qmake := findQmake(profile)
+	buf, err := r.run(exec.Command(qmake, queryFlag(qmake)))
+	if err != nil {
+		err = fmt.Errorf("qt info: %v", err)
+		return
+	}
+	query := parseQmakeQuery(buf)
+	info = qtInfo{
+		Version:         query["QT_VERSION"],
+		Qmake:           qmake,
+		BasePath:        query["QT_INSTALL_PREFIX"],
+		LibPath:         query["QT_INSTALL_LIBS"],
+		PluginPath:      query["QT_INSTALL_PLUGINS"],
+		QmlPath:         query["QT_INSTALL_QML"],
+		BinPath:         query["QT_INSTALL_BINS"],
+		TranslationPath: query["QT_INSTALL_TRANSLATIONS"],
+		HeaderPath:      query["QT_INSTALL_HEADERS"],
+	}
+	for key, val := range map[string]string{
+		"QT_VERSION":         info.Version,
+		"QT_INSTALL_LIBS":    info.LibPath,
+		"QT_INSTALL_PLUGINS": info.PluginPath,
+		"QT_INSTALL_BINS":    info.BinPath,
+	} {
+		if len(val) < 1 {
+			err = fmt.Errorf("qt info: %s: no %s in query output", qmake, key)
+			return
+		}
+	}
+	info.Major = strings.SplitN(info.Version, ".", 2)[0]
+	if info.Major != "5" && info.Major != "6" {
+		err = fmt.Errorf("qt info: unsupported Qt version: %s", info.Version)
+		return
+	}
+	if len(info.QmlPath) < 1 && len(info.BasePath) > 0 {
+		info.QmlPath = filepath.Join(info.BasePath, "qml")
+	}
+	return
+}
+
+// findQmake returns the qmake binary that should be queried for Qt paths.
+func findQmake(profile *deployProfile) string {
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	if qmake := os.Getenv("QMLKIT_QMAKE"); len(qmake) > 0 {
+		return qmake
+	}
+	if dir := os.Getenv("QMLKIT_QT_DIR"); len(dir) > 0 {
+		return filepath.Join(dir, "bin", "qmake"+exe)
+	}
+	if len(profile.Qmake) > 0 {
+		return profile.Qmake
+	}
+	if len(profile.QtDir) > 0 {
+		return filepath.Join(profile.QtDir, "bin", "qmake"+exe)
+	}
+	for _, name := range []string{"qmake", "qmake6", "qtpaths6"} {
+		if path, err := exec.LookPath(name + exe); err == nil {
+			return path
+		}
+	}
+	return "qmake" + exe
+}
+
+// queryFlag returns the flag that makes the tool print its Qt properties,
+// qtpaths of Qt 6 understands the same keys as qmake does.
+func queryFlag(qmake string) string {
+	if strings.HasPrefix(filepath.Base(qmake), "qtpaths") {
+		return "--query"
+	}
+	return "-query"
+}
+
+// parseQmakeQuery parses `qmake -query` output into a key-value map.
+// The /get, /src and other flavoured keys are skipped, values are taken as is
+// so paths with spaces and drive letters survive.
+func parseQmakeQuery(buf []byte) map[string]string {
+	query := make(map[string]string)
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimRight(line, "\r")
+		idx := strings.Index(line, ":")
+		if idx < 1 {
+			continue
+		}
+		key := line[:idx]
+		if strings.Contains(key, "/") {
+			continue
+		}
+		query[key] = line[idx+1:]
+	}
+	return query
+}
+
+// moduleName maps a QML module dir as listed in the profile to the layout of the
+// detected Qt. Qt 6 dropped the major version suffix, so QtQuick.2 becomes QtQuick.
+func (q qtInfo) moduleName(name string) string {
+	if q.Major == "5" {
+		return name
+	}
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for i, part := range parts {
+		if idx := strings.LastIndex(part, "."); idx > 0 && isDigits(part[idx+1:]) {
+			parts[i] = part[:idx]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// FrameworkVersion returns the version dir of Qt frameworks on darwin.
+func (q qtInfo) FrameworkVersion() string {
+	if q.Major == "5" {
+		return "5"
+	}
+	return "A"
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isDigits(s string) bool {
+	if len(s) < 1 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// getReleaseInfo resolves the version of the app: the --version flag goes first, then
+// the version key of the profile and `git describe` output as the last resort.
+// The commit is taken from git, if any, the date from releaseTime. Git is run in
+// the package dir, so the repo of the package is described rather than the cwd one.
+func getReleaseInfo(r *runner, pkg pkgInfo, version string, profile *deployProfile) (info releaseInfo, err error) {
+	info.Version = version
+	if len(info.Version) < 1 {
+		info.Version = profile.Version
+	}
+	if len(info.Version) < 1 {
+		cmd := exec.Command("git", "describe", "--tags", "--dirty")
+		cmd.Dir = pkg.Dir
+		if buf, err := r.run(cmd); err == nil {
+			info.Version = strings.TrimSpace(string(buf))
+		}
+	}
+	if len(info.Version) < 1 {
+		info.Version = "0.0.0-dev"
+	}
+	if err = info.check(); err != nil {
+		return
+	}
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = pkg.Dir
+	if buf, err := r.run(cmd); err == nil {
+		info.Commit = strings.TrimSpace(string(buf))
+	}
+	if info.Time, err = releaseTime(r, pkg.Dir); err != nil {
+		return
+	}
+	info.Date = info.Time.Format(time.RFC3339)
+	return
+}
+
+// Short returns the numeric part of the version, i.e. 1.2.3 for v1.2.3-4-gdeadbeef.
+func (r releaseInfo) Short() string {
+	v := strings.TrimPrefix(r.Version, "v")
+	end := 0
+	for end < len(v) && (v[end] >= '0' && v[end] <= '9' || v[end] == '.') {
+		end++
+	}
+	v = strings.Trim(v[:end], ".")
+	if len(v) < 1 {
+		return "0.0.0"
+	}
+	return v
+}
+
+// check reports versions which can't be stamped into binaries: linker flags can't
+// hold spaces or quotes, and Short must fit version resources, that is up to four
+// numbers no greater than 65535.
+func (r releaseInfo) check() error {
+	if strings.IndexFunc(r.Version, func(c rune) bool {
+		return unicode.IsSpace(c) || !unicode.IsPrint(c) || c == '\'' || c == '"'
+	}) >= 0 {
+		return fmt.Errorf("bad version %q: spaces and quotes are not allowed", r.Version)
+	}
+	parts := strings.Split(r.Short(), ".")
+	if len(parts) > 4 {
+		return fmt.Errorf("bad version %s: more than four numbers", r.Version)
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 16); err != nil {
+			return fmt.Errorf("bad version %s: %q is not a number up to 65535", r.Version, part)
+		}
+	}
+	return nil
+}
+
+// fileName returns the base name for output files like disk images.
+func (r releaseInfo) fileName(name string) string {
+	return name + "-" + strings.TrimPrefix(r.Version, "v")
+}
+
+// goBuildCmd returns the command building the package into out according to
+// the build section of the profile, release info is stamped into main.version,
+// main.commit and main.buildDate. The values need no quoting, getReleaseInfo
+// rejects versions with spaces or quotes.
+func goBuildCmd(cfg *config, pkg pkgInfo, out string, env ...string) *exec.Cmd {
+	build := cfg.Profile.Build
+	ldflags := fmt.Sprintf("-X main.version=%s -X main.commit=%s -X main.buildDate=%s -buildid=%s",
+		cfg.Release.Version, cfg.Release.Commit, cfg.Release.Date, build.Buildid)
+	if len(build.Ldflags) > 0 {
+		ldflags += " " + build.Ldflags
+	}
+	args := []string{"build", "-ldflags", ldflags}
+	if len(build.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(build.Tags, ","))
+	}
+	if len(build.Gcflags) > 0 {
+		args = append(args, "-gcflags", build.Gcflags)
+	}
+	// paths of the build machine and random build ids make binaries differ
+	if build.trimpath() {
+		args = append(args, "-trimpath")
+	}
+	if build.Race {
+		args = append(args, "-race")
+	}
+	args = append(args, build.Args...)
+	if abs, err := filepath.Abs(out); err == nil {
+		out = abs
+	}
+	args = append(args, "-o", out, ".")
+	// build from the package dir, so its module (and vendor dir) is used
+	cmd := exec.Command("go", args...)
+	cmd.Dir = pkg.Dir
+	cmd.Env = append(os.Environ(), envList(buildEnv(cfg))...)
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
+}
+
+// goBuildUniversal builds the package for each of universalArches and merges
+// the results into a fat binary at out.
+func goBuildUniversal(cfg *config, pkg pkgInfo, out string) (err error) {
+	tmp, err := ioutil.TempDir("", "qmlkit")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	var thin []string
+	for _, arch := range universalArches {
+		name := filepath.Join(tmp, pkg.Name+"_"+arch)
+		// cgo is off by default when GOARCH differs from the host one
+		if err = goBuild(cfg, pkg, name, "GOARCH="+arch, "CGO_ENABLED=1"); err != nil {
+			return
+		}
+		thin = append(thin, name)
+	}
+	return writeFatMachO(out, thin)
+}
+
+// buildEnv returns env vars of go build: cgo settings matching the deployed Qt
+// and the ones from the build section of profile, the latter take precedence.
+func buildEnv(cfg *config) map[string]string {
+	env := cgoEnv(cfg.runner, cfg.QtInfo)
+	for key, val := range cfg.Profile.Build.Env {
+		env[key] = val
+	}
+	return env
+}
+
+// buildArch returns GOARCH binaries are built for: the one of the build env,
+// the one of the process env or the host one.
+func buildArch(cfg *config) string {
+	if goarch := buildEnv(cfg)["GOARCH"]; len(goarch) > 0 {
+		return goarch
+	}
+	if goarch := os.Getenv("GOARCH"); len(goarch) > 0 {
+		return goarch
+	}
+	return runtime.GOARCH
+}
+
+// envList turns env map into sorted KEY=VALUE pairs.
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, val := range env {
+		list = append(list, key+"="+val)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// goBuild builds the package into out, env (KEY=VALUE pairs) takes precedence over
+// the build env. The effective command line is reported as a debug event.
+func goBuild(cfg *config, pkg pkgInfo, out string, env ...string) error {
+	cmd := goBuildCmd(cfg, pkg, out, env...)
+	cfg.debugf("%s", commandLine(append(envList(buildEnv(cfg)), env...), cmd.Args))
+	if err := checkPkgConfig(cfg.runner, cmd.Env, cfg.QtInfo); err != nil {
+		return err
+	}
+	if _, err := cfg.run(cmd); err != nil {
+		return err
+	}
+	return checkLinkedQt(out, cfg.QtInfo)
+}
+
+// run runs an external command and returns its stdout. The command is killed
+// when the timeout passes or the context is cancelled (i.e. on interrupt). Errors carry
+// the command line and trimmed stderr, output is streamed to r.output if set.
+func (r *runner) run(cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if r.output != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, r.output)
+		cmd.Stderr = io.MultiWriter(&stderr, r.output)
+	}
+	// the pipes are closed then, otherwise Wait blocks while grandchildren live
+	cmd.WaitDelay = r.waitDelay
+	line := commandLine(nil, cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %v", line, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case err = <-done:
+	case <-timer.C:
+		cmd.Process.Kill()
+		<-done
+		err = fmt.Errorf("timed out after %v", r.timeout)
+	case <-r.ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		err = r.ctx.Err()
+	}
+	if err != nil {
+		if msg := trimOutput(stderr.String()); len(msg) > 0 {
+			return stdout.Bytes(), fmt.Errorf("%s: %v\n%s", line, err, msg)
+		}
+		return stdout.Bytes(), fmt.Errorf("%s: %v", line, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// trimOutput trims the command output to its last lines.
+func trimOutput(out string) string {
+	const maxLines = 40
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) > maxLines {
+		lines = append([]string{"..."}, lines[len(lines)-maxLines:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commandLine formats the command for logs, args with spaces are quoted.
+func commandLine(env, args []string) string {
+	var parts []string
+	for _, arg := range append(append([]string{}, env...), args...) {
+		if strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// override overrides the build section of profile with options set in o.
+func (b *BuildOptions) override(o BuildOptions) {
+	if len(o.Tags) > 0 {
+		b.Tags = o.Tags
+	}
+	if len(o.Ldflags) > 0 {
+		b.Ldflags = o.Ldflags
+	}
+	if len(o.Gcflags) > 0 {
+		b.Gcflags = o.Gcflags
+	}
+	if o.Trimpath != nil {
+		b.Trimpath = o.Trimpath
+	}
+	if len(o.Buildid) > 0 {
+		b.Buildid = o.Buildid
+	}
+	b.Race = b.Race || o.Race
+	if len(o.Env) > 0 && b.Env == nil {
+		b.Env = make(map[string]string)
+	}
+	for key, val := range o.Env {
+		b.Env[key] = val
+	}
+	if len(o.Args) > 0 {
+		b.Args = o.Args
+	}
+}
+
+// getTarget returns the target by name, the current platform by default.
+// Qt is linked with cgo, so only targets of the current platform can be deployed.
+func getTarget(name string) (string, error) {
+	if len(name) < 1 {
+		name = runtime.GOOS
+	}
+	target, ok := LookupTarget(name)
+	if !ok {
+		return "", fmt.Errorf("deploy: target unsupported: %s", name)
+	}
+	if target.GOOS != runtime.GOOS {
+		return "", fmt.Errorf("deploy: target %s is deployed on %s only", name, target.GOOS)
+	}
+	return name, nil
+}
+
+// readProfile loads the deploy profile of the project.
+func readProfile(name string) (profile deployProfile, err error) {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal(buf, &profile); err != nil {
+		err = fmt.Errorf("deploy: profile: %v", err)
+	}
+	return
+}
+
+// getPkgInfo fetches info about package being deployed.
+func getPkgInfo(r *runner, pattern string) (info pkgInfo, err error) {
+	cmd := exec.Command("go", "list", "-f",
+		"{{.ImportPath}}\n{{.Dir}}\n{{with .Module}}{{.Dir}}{{end}}\n{{.Name}}")
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		// a dir may belong to another module, so list it from inside
+		cmd.Dir = pattern
+		pattern = "."
+	}
+	cmd.Args = append(cmd.Args, pattern)
+	buf, err := r.run(cmd)
+	if err != nil {
+		err = fmt.Errorf("pkg info: %v", err)
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(buf), "\r\n"), "\n")
+	switch {
+	case len(lines)%4 != 0:
+		err = fmt.Errorf("pkg info: go list unexpected output")
+		return
+	case len(lines) > 4:
+		err = fmt.Errorf("pkg info: %s matches %d packages, choose one", pattern, len(lines)/4)
+		return
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	if lines[3] != "main" {
+		err = fmt.Errorf("pkg info: %s is not a main package", lines[0])
+		return
+	}
+	path := lines[0]
+	info = pkgInfo{
+		Name:       execName(path),
+		ImportPath: path,
+		Dir:        lines[1],
+		Root:       lines[2],
+	}
+	if len(info.Root) < 1 {
+		info.Root = info.Dir
+	}
+	info.Base = findAssetsBase(info.Dir, info.Root)
+	return
+}
+
+// execName returns the name go build gives the binary of the package, the major
+// version suffix of a module path (i.e. /v2) is skipped.
+func execName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// isMajorVersion reports whether elem is a major version suffix v2, v3 and so on.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' || elem[1] == '0' {
+		return false
+	}
+	for _, c := range elem[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return elem != "v1"
+}
+
+// getBinaries resolves binaries of the profile, the package itself is the only
+// (and primary) one if the profile lists none. If no binary is marked primary
+// the first one is.
+func getBinaries(r *runner, pkg pkgInfo, profile *deployProfile) (bins []binaryInfo, err error) {
+	if len(profile.Binaries) < 1 {
+		return []binaryInfo{{Pkg: pkg, Primary: true}}, nil
+	}
+	names := make(map[string]bool)
+	primary := -1
+	for i, b := range profile.Binaries {
+		pattern := b.Package
+		if len(pattern) < 1 {
+			err = fmt.Errorf("deploy: binaries: no package for #%d", i+1)
+			return
+		}
+		if strings.HasPrefix(pattern, ".") {
+			pattern = pkg.path(pattern)
+		}
+		info, err := getPkgInfo(r, pattern)
+		if err != nil {
+			return nil, err
+		}
+		info.Base = pkg.Base
+		if len(b.Name) > 0 {
+			info.Name = b.Name
+		}
+		if names[info.Name] {
+			return nil, fmt.Errorf("deploy: binaries: duplicate name %s", info.Name)
+		}
+		names[info.Name] = true
+		if b.Primary {
+			if primary >= 0 {
+				return nil, fmt.Errorf("deploy: binaries: both %s and %s are primary",
+					bins[primary].Pkg.Name, info.Name)
+			}
+			primary = i
+		}
+		bins = append(bins, binaryInfo{Pkg: info, Primary: b.Primary})
+	}
+	if primary < 0 {
+		bins[0].Primary = true
+	}
+	return
+}
+
+// primaryBinary returns the binary the package is named after.
+func primaryBinary(bins []binaryInfo) binaryInfo {
+	for _, bin := range bins {
+		if bin.Primary {
+			return bin
+		}
+	}
+	return bins[0]
+}
+
+// findAssetsBase looks for the project dir starting from the package dir and up
+// to the module root, so commands under cmd/ may share assets of the repo.
+// The package dir is returned if there is none.
+func findAssetsBase(dir, root string) string {
+	for path := dir; ; path = filepath.Dir(path) {
+		if fi, err := os.Stat(filepath.Join(path, "project")); err == nil && fi.IsDir() {
+			return path
+		}
+		if samePath(path, root) || filepath.Dir(path) == path {
+			return dir
+		}
+	}
+}
+
+// path resolves a path of the profile, relative ones are taken from the base dir.
+func (p pkgInfo) path(name string) string {
+	if filepath.IsAbs(name) || len(p.Base) < 1 {
+		return name
+	}
+	return filepath.Join(p.Base, name)
+}
+
+// riceCmd runs rice in the package dir, rice works on the package there.
+func riceCmd(pkg pkgInfo, command string) *exec.Cmd {
+	cmd := exec.Command("rice", command)
+	cmd.Dir = pkg.Dir
+	return cmd
+}
+
+// darwinRelink makes paths of linked libraries relative to executable (or to @rpath,
+// depending on base).
+//
+//   /usr/local/Cellar/qt5/5.3.0/lib/QtWidgets.framework/Versions/5/QtWidgets
+//   /usr/local/opt/qt5/lib/QtWidgets.framework/Versions/5/QtWidgets
+//   ->
+//   @executable_path/../Frameworks/QtWidgets.framework/Versions/5/QtWidgets
+func darwinRelink(r *runner, qlib, name, base string, strict bool) (err error) {
+	file, closer, err := openMachO(name)
+	if err != nil {
+		return
+	}
+	defer closer.Close()
+	libs, err := file.ImportedLibraries()
+	if err != nil {
+		return
+	}
+	var qlib2 string
+	// detect alternative qlib (homebrew symlinks Qt to /usr/local/opt)
+	for _, lib := range libs {
+		idx := strings.Index(lib, "QtCore")
+		if idx > 0 {
+			qlib2 = lib[:idx-1] // drop sep
+			break
+		}
+	}
+	replacer := strings.NewReplacer(qlib, base, qlib2, base)
+	if len(qlib2) < 1 && strict {
+		return fmt.Errorf("darwin relink: corrupt binary: %s", name)
+	} else if !strict {
+		replacer = strings.NewReplacer(qlib, base)
+	}
+	// replace qlib/qlib2 to base
+	for _, lib := range libs {
+		rlib := replacer.Replace(lib)
+		if rlib == lib {
+			continue
+		}
+		cmd := exec.Command("install_name_tool", "-change", lib, rlib, name)
+		if _, err = r.run(cmd); err != nil {
+			return fmt.Errorf("darwin relink: %v", err)
+		}
+	}
+	return
+}
+
+// darwinAddRpath adds LC_RPATH entry to the binary unless it has one already.
+func darwinAddRpath(r *runner, name, rpath string) (err error) {
+	file, closer, err := openMachO(name)
+	if err != nil {
+		return
+	}
+	for _, load := range file.Loads {
+		if r, ok := load.(*macho.Rpath); ok && r.Path == rpath {
+			closer.Close()
+			return
+		}
+	}
+	closer.Close()
+	cmd := exec.Command("install_name_tool", "-add_rpath", rpath, name)
+	if _, err = r.run(cmd); err != nil {
+		return fmt.Errorf("darwin rpath: %v", err)
+	}
+	return
+}
+
+// darwinSetID changes LC_ID_DYLIB of the shared library.
+func darwinSetID(r *runner, name, id string) (err error) {
+	cmd := exec.Command("install_name_tool", "-id", id, name)
+	if _, err = r.run(cmd); err != nil {
+		return fmt.Errorf("darwin id: %v", err)
+	}
+	return
+}
+
+// loaderRpath returns the rpath to Frameworks dir relative to the binary,
+// i.e. @loader_path/../../Frameworks for a plugin in Plugins/platforms.
+func loaderRpath(name, fwDir string) string {
+	rel, err := filepath.Rel(filepath.Dir(name), fwDir)
+	if err != nil {
+		return relinkBase
+	}
+	return "@loader_path/" + filepath.ToSlash(rel)
+}
+
+// writeInfoPlist writes manifest for .app package to file.
+func writeInfoPlist(path string, cfg *config, icon string) error {
+	bundle := cfg.Profile.Bundle
+	id := bundle.Identifier
+	if len(id) < 1 {
+		id = bundleIdentifier(cfg.PkgInfo.ImportPath)
+	}
+	if !validBundleIdentifier(id) {
+		return fmt.Errorf("bundle: invalid identifier: %s", id)
+	}
+	name := bundle.Name
+	if len(name) < 1 {
+		name = cfg.PkgInfo.Name
+	}
+	info := map[string]interface{}{
+		"NSPrincipalClass":      "NSApplication",
+		"CFBundlePackageType":   "APPL",
+		"CFBundleGetInfoString": "Powered by Go QML",
+		"CFBundleSignature":     "????",
+		"CFBundleExecutable":    cfg.PkgInfo.Name,
+		"CFBundleIdentifier":    id,
+		"CFBundleName":          name,
+	}
+	if len(icon) > 0 {
+		info["CFBundleIconFile"] = icon
+	}
+	if len(bundle.DisplayName) > 0 {
+		info["CFBundleDisplayName"] = bundle.DisplayName
+	}
+	info["CFBundleShortVersionString"] = cfg.Release.Short()
+	if len(bundle.Version) > 0 {
+		info["CFBundleShortVersionString"] = bundle.Version
+	}
+	info["CFBundleVersion"] = cfg.Release.Short()
+	if len(bundle.Build) > 0 {
+		info["CFBundleVersion"] = bundle.Build
+	}
+	if len(bundle.MinimumSystemVersion) > 0 {
+		info["LSMinimumSystemVersion"] = bundle.MinimumSystemVersion
+	}
+	if bundle.HighResolution == nil || *bundle.HighResolution {
+		info["NSHighResolutionCapable"] = true
+	}
+	var docTypes []interface{}
+	for _, doc := range bundle.DocumentTypes {
+		docType := map[string]interface{}{
+			"CFBundleTypeName": doc.Name,
+			"CFBundleTypeRole": "Viewer",
+		}
+		if len(doc.Role) > 0 {
+			docType["CFBundleTypeRole"] = doc.Role
+		}
+		if len(doc.Extensions) > 0 {
+			docType["CFBundleTypeExtensions"] = doc.Extensions
+		}
+		if len(doc.Types) > 0 {
+			docType["LSItemContentTypes"] = doc.Types
+		}
+		if len(doc.Icon) > 0 {
+			docType["CFBundleTypeIconFile"] = doc.Icon
+		}
+		docTypes = append(docTypes, docType)
+	}
+	if len(docTypes) > 0 {
+		info["CFBundleDocumentTypes"] = docTypes
+	}
+	var urlTypes []interface{}
+	for _, url := range bundle.URLSchemes {
+		urlName := url.Name
+		if len(urlName) < 1 {
+			urlName = id
+		}
+		urlTypes = append(urlTypes, map[string]interface{}{
+			"CFBundleURLName":    urlName,
+			"CFBundleURLSchemes": url.Schemes,
+		})
+	}
+	if len(urlTypes) > 0 {
+		info["CFBundleURLTypes"] = urlTypes
+	}
+	for key, val := range bundle.Extra {
+		info[key] = val
+	}
+
+	return writePlist(filepath.Join(path, "Info.plist"), info)
+}
+
+// bundleIdentifier derives a reverse-DNS identifier from the import path,
+// i.e. github.com/foo/bar_baz -> com.github.foo.bar-baz.
+func bundleIdentifier(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	var id []string
+	if strings.Contains(parts[0], ".") {
+		host := strings.Split(parts[0], ".")
+		for i := len(host) - 1; i >= 0; i-- {
+			id = append(id, host[i])
+		}
+		parts = parts[1:]
+	} else {
+		id = append(id, "local")
+	}
+	for _, part := range parts {
+		id = append(id, strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+				return r
+			}
+			return '-'
+		}, part))
+	}
+	return strings.Join(id, ".")
+}
+
+// validBundleIdentifier checks that id is a reverse-DNS string made of
+// alphanumerics, hyphens and periods.
+func validBundleIdentifier(id string) bool {
+	parts := strings.Split(id, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if len(part) < 1 {
+			return false
+		}
+		for _, r := range part {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isMachO checks whether the file starts with one of Mach-O magic numbers.
+func isMachO(name string) bool {
+	file, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	var magic [4]byte
+	if _, err := io.ReadFull(file, magic[:]); err != nil {
+		return false
+	}
+	switch binary.BigEndian.Uint32(magic[:]) {
+	case macho.Magic32, macho.Magic64, macho.MagicFat, 0xcefaedfe, 0xcffaedfe:
+		return true
+	}
+	return false
+}
+
+// copyFramework recreates the structure of orig framework in targ and returns path
+// of the framework binary. Only the current version is copied, without headers
+// and debug binaries:
+//
+//   QtCore.framework/QtCore -> Versions/Current/QtCore
+//   QtCore.framework/Resources -> Versions/Current/Resources
+//   QtCore.framework/Versions/Current -> 5
+//   QtCore.framework/Versions/5/QtCore
+//   QtCore.framework/Versions/5/Resources/Info.plist
+//
+// Older Qt releases keep Info.plist in the Contents dir of the framework,
+// it is moved to Resources since codesign expects it there.
+func copyFramework(orig, targ string, qt qtInfo) (binary string, err error) {
+	name := strings.TrimSuffix(filepath.Base(orig), ".framework")
+	version := qt.FrameworkVersion()
+	origDir := filepath.Join(orig, "Versions", version)
+	targDir := filepath.Join(targ, "Versions", version)
+	if err = os.MkdirAll(targDir, 0755); err != nil {
+		return
+	}
+	binary = filepath.Join(targDir, name)
+	if err = copyFile(filepath.Join(origDir, name), binary); err != nil {
+		return
+	}
+	if err = os.Chmod(binary, 0755); err != nil {
+		return
+	}
+	resources := filepath.Join(targDir, "Resources")
+	if _, err = os.Stat(filepath.Join(origDir, "Resources")); err == nil {
+		if err = copyTree(filepath.Join(origDir, "Resources"), resources); err != nil {
+			return
+		}
+	} else if err = os.Mkdir(resources, 0755); err != nil {
+		return
+	}
+	plist := filepath.Join(resources, "Info.plist")
+	if _, err = os.Stat(plist); os.IsNotExist(err) {
+		legacy := filepath.Join(orig, "Contents", "Info.plist")
+		if _, err = os.Stat(legacy); err == nil {
+			err = copyFile(legacy, plist)
+		} else {
+			err = writePlist(plist, map[string]interface{}{
+				"CFBundlePackageType": "FMWK",
+				"CFBundleExecutable":  name,
+				"CFBundleIdentifier":  "org.qt-project." + name,
+				"CFBundleVersion":     qt.Version,
+			})
+		}
+	}
+	if err != nil {
+		return
+	}
+	links := [][2]string{
+		{version, filepath.Join(targ, "Versions", "Current")},
+		{filepath.Join("Versions", "Current", name), filepath.Join(targ, name)},
+		{filepath.Join("Versions", "Current", "Resources"), filepath.Join(targ, "Resources")},
+	}
+	for _, link := range links {
+		if err = os.Symlink(link[0], link[1]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// copyTree recursively copies orig dir into the targ dir.
+func copyTree(orig, targ string) (err error) {
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(orig, path)
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			if strings.HasPrefix(info.Name(), ".") {
+				return nil
+			}
+			err = copyFile(path, filepath.Join(targ, name))
+		} else {
+			err = os.Mkdir(filepath.Join(targ, name), 0755)
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	if err = filepath.Walk(orig, walkFn); err != nil {
+		return
+	}
+	return
+}
+
+// copyFile effectively copies a file orig to file targ.
+func copyFile(orig, targ string) (err error) {
+	in, err := os.Open(orig)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(targ)
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		return
+	}
+	return
+}
+
+const shRun = `#!/bin/sh
+appname=` + "`basename $0 | sed s,\\.sh$,,`" + `
+dirname=` + "`dirname $0`" + `
+tmp="${dirname#?}"
+
+if [ "${dirname%$tmp}" != "/" ]; then
+dirname=$PWD/$dirname
+fi
+LD_LIBRARY_PATH=$dirname
+export LD_LIBRARY_PATH
+$dirname/$appname "$@"
+`
@@ -0,0 +1,756 @@
+// deploy_test.go — tests of the deployment routines, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeQmake writes a shell script named name into dir that prints query when
+// run with flag, it fails otherwise.
+func fakeQmake(t *testing.T, dir, name, flag, query string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake qmake is a shell script")
+	}
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\n" +
+		"[ \"$1\" = \"" + flag + "\" ] || { echo \"unexpected $1\" >&2; exit 1; }\n" +
+		"cat <<'EOF'\n" + query + "EOF\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const qt5Query = `QT_SYSROOT:
+QT_INSTALL_PREFIX:/opt/Qt 5.3/gcc_64
+QT_INSTALL_PREFIX/raw:/opt/Qt 5.3/gcc_64
+QT_INSTALL_LIBS:/opt/Qt 5.3/gcc_64/lib
+QT_INSTALL_PLUGINS:/opt/Qt 5.3/gcc_64/plugins
+QT_INSTALL_QML:/opt/Qt 5.3/gcc_64/qml
+QT_INSTALL_BINS:/opt/Qt 5.3/gcc_64/bin
+QT_INSTALL_TRANSLATIONS:/opt/Qt 5.3/gcc_64/translations
+QT_INSTALL_HEADERS:/opt/Qt 5.3/gcc_64/include
+QT_HOST_PREFIX/get:/somewhere/else
+QT_VERSION:5.3.0
+`
+
+func TestParseQmakeQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{
+			"flavoured keys skipped",
+			"QT_INSTALL_LIBS:/usr/lib\nQT_INSTALL_LIBS/get:/other\nQT_INSTALL_LIBS/src:/src\n",
+			map[string]string{"QT_INSTALL_LIBS": "/usr/lib"},
+		},
+		{
+			"crlf and drive letters",
+			"QT_INSTALL_LIBS:C:\\Qt\\5.3\\lib\r\nQT_VERSION:5.3.0\r\n",
+			map[string]string{"QT_INSTALL_LIBS": "C:\\Qt\\5.3\\lib", "QT_VERSION": "5.3.0"},
+		},
+		{
+			"spaces and empty values",
+			"QT_SYSROOT:\nQT_INSTALL_PREFIX:/opt/Qt 5.3\n\nnot a key\n:no key\n",
+			map[string]string{"QT_SYSROOT": "", "QT_INSTALL_PREFIX": "/opt/Qt 5.3"},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseQmakeQuery([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindQmake(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("qmake is looked up with .exe suffix")
+	}
+	bin := t.TempDir()
+	qmake6 := fakeQmake(t, bin, "qmake6", "-query", "")
+	tests := []struct {
+		name    string
+		qmake   string // $QMLKIT_QMAKE
+		qtdir   string // $QMLKIT_QT_DIR
+		profile deployProfile
+		want    string
+	}{
+		{"env qmake", "/env/qmake", "/env/qt", deployProfile{Qmake: "/profile/qmake"}, "/env/qmake"},
+		{"env qt dir", "", "/env/qt", deployProfile{Qmake: "/profile/qmake"}, "/env/qt/bin/qmake"},
+		{"profile qmake", "", "", deployProfile{Qmake: "/profile/qmake", QtDir: "/profile/qt"}, "/profile/qmake"},
+		{"profile qt dir", "", "", deployProfile{QtDir: "/profile/qt"}, "/profile/qt/bin/qmake"},
+		{"path", "", "", deployProfile{}, qmake6},
+	}
+	for _, tt := range tests {
+		t.Setenv("QMLKIT_QMAKE", tt.qmake)
+		t.Setenv("QMLKIT_QT_DIR", tt.qtdir)
+		t.Setenv("PATH", bin)
+		if got := findQmake(&tt.profile); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetQtInfo(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		tool  string
+		flag  string
+		query string
+		want  qtInfo
+		err   string
+	}{
+		{
+			name:  "qt5",
+			tool:  "qmake",
+			flag:  "-query",
+			query: qt5Query,
+			want: qtInfo{
+				Version:         "5.3.0",
+				Major:           "5",
+				BasePath:        "/opt/Qt 5.3/gcc_64",
+				LibPath:         "/opt/Qt 5.3/gcc_64/lib",
+				PluginPath:      "/opt/Qt 5.3/gcc_64/plugins",
+				QmlPath:         "/opt/Qt 5.3/gcc_64/qml",
+				BinPath:         "/opt/Qt 5.3/gcc_64/bin",
+				TranslationPath: "/opt/Qt 5.3/gcc_64/translations",
+				HeaderPath:      "/opt/Qt 5.3/gcc_64/include",
+			},
+		},
+		{
+			name: "qtpaths6 without qml path",
+			tool: "qtpaths6",
+			flag: "--query",
+			query: "QT_VERSION:6.5.1\nQT_INSTALL_PREFIX:/opt/qt6\nQT_INSTALL_LIBS:/opt/qt6/lib\n" +
+				"QT_INSTALL_PLUGINS:/opt/qt6/plugins\nQT_INSTALL_BINS:/opt/qt6/bin\n",
+			want: qtInfo{
+				Version:    "6.5.1",
+				Major:      "6",
+				BasePath:   "/opt/qt6",
+				LibPath:    "/opt/qt6/lib",
+				PluginPath: "/opt/qt6/plugins",
+				QmlPath:    "/opt/qt6/qml",
+				BinPath:    "/opt/qt6/bin",
+			},
+		},
+		{
+			name:  "missing key",
+			tool:  "qmake-nolibs",
+			flag:  "-query",
+			query: "QT_VERSION:5.3.0\nQT_INSTALL_PLUGINS:/p\nQT_INSTALL_BINS:/b\n",
+			err:   "no QT_INSTALL_LIBS",
+		},
+		{
+			name:  "unsupported version",
+			tool:  "qmake-qt4",
+			flag:  "-query",
+			query: "QT_VERSION:4.8.6\nQT_INSTALL_LIBS:/l\nQT_INSTALL_PLUGINS:/p\nQT_INSTALL_BINS:/b\n",
+			err:   "unsupported Qt version: 4.8.6",
+		},
+		{
+			name: "failing tool",
+			tool: "qmake-broken",
+			flag: "--wrong",
+			err:  "unexpected -query",
+		},
+	}
+	for _, tt := range tests {
+		qmake := fakeQmake(t, dir, tt.tool, tt.flag, tt.query)
+		t.Setenv("QMLKIT_QMAKE", qmake)
+		info, err := getQtInfo(newRunner(&Config{}), &deployProfile{})
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		tt.want.Qmake = qmake
+		if !reflect.DeepEqual(info, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, info, tt.want)
+		}
+	}
+}
+
+// testConfig returns a config with the profile shipped with the kit and a Qt
+// install of the given major version.
+func testConfig(t *testing.T, major string) *config {
+	t.Helper()
+	profile, err := readProfile(filepath.Join("..", deployProfileSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qt := t.TempDir()
+	return &config{
+		runner:  newRunner(&Config{}),
+		PkgInfo: pkgInfo{Name: "app", ImportPath: "example.com/app", Base: t.TempDir()},
+		QtInfo: qtInfo{
+			Version:         major + ".0.0",
+			Major:           major,
+			BasePath:        qt,
+			LibPath:         filepath.Join(qt, "lib"),
+			PluginPath:      filepath.Join(qt, "plugins"),
+			QmlPath:         filepath.Join(qt, "qml"),
+			BinPath:         filepath.Join(qt, "bin"),
+			TranslationPath: filepath.Join(qt, "translations"),
+		},
+		Path:    t.TempDir(),
+		Profile: profile,
+	}
+}
+
+// planned returns destinations of the plan files of kind.
+func planned(plan Plan, kind string) (dsts []string) {
+	for _, f := range plan.Files {
+		if f.Kind == kind {
+			dsts = append(dsts, f.Dst)
+		}
+	}
+	return
+}
+
+func TestPlanLayoutModules(t *testing.T) {
+	tests := []struct {
+		major string
+		want  []string
+	}{
+		{"5", []string{"qml/QtQuick.2", "qml/QtQuick/Controls", "qml/QtQuick/Layouts", "qml/QtQuick/Window.2"}},
+		// the whole QtQuick tree holds Controls, Layouts and Window already
+		{"6", []string{"qml/QtQuick"}},
+	}
+	for _, tt := range tests {
+		plan, err := planLayout(testConfig(t, tt.major), "linux")
+		if err != nil {
+			t.Fatalf("Qt %s: %v", tt.major, err)
+		}
+		if got := planned(plan, "modules"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Qt %s: got modules %v, want %v", tt.major, got, tt.want)
+		}
+	}
+}
+
+func TestCopyFilesQt6Modules(t *testing.T) {
+	cfg := testConfig(t, "6")
+	for _, name := range []string{"qmldir", "Controls/qmldir", "Layouts/qmldir", "Window/qmldir"} {
+		path := filepath.Join(cfg.QtInfo.QmlPath, "QtQuick", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	job, err := newJob(cfg, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = job.CopyFiles("modules"); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(job.Root, "qml", "QtQuick", "Window", "qmldir"))
+	if err != nil || string(buf) != "Window/qmldir" {
+		t.Errorf("got %q, %v", buf, err)
+	}
+}
+
+// writeFiles creates files under root with the given contents.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopyFramework(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("frameworks use symlinks")
+	}
+	tests := []struct {
+		name  string
+		major string
+		files map[string]string // of the original framework
+		plist string            // expected in Info.plist
+	}{
+		{
+			name:  "qt5",
+			major: "5",
+			files: map[string]string{
+				"Versions/5/QtCore":                    "binary",
+				"Versions/5/QtCore_debug":              "debug",
+				"Versions/5/Headers/qglobal.h":         "header",
+				"Versions/5/Resources/Info.plist":      "<plist>qt5</plist>",
+				"Versions/5/Resources/en.lproj/x.strs": "strings",
+			},
+			plist: "<plist>qt5</plist>",
+		},
+		{
+			name:  "qt6",
+			major: "6",
+			files: map[string]string{
+				"Versions/A/QtCore":               "binary",
+				"Versions/A/Headers/qglobal.h":    "header",
+				"Versions/A/Resources/Info.plist": "<plist>qt6</plist>",
+			},
+			plist: "<plist>qt6</plist>",
+		},
+		{
+			name:  "legacy plist",
+			major: "5",
+			files: map[string]string{
+				"Versions/5/QtCore":   "binary",
+				"Contents/Info.plist": "<plist>legacy</plist>",
+			},
+			plist: "<plist>legacy</plist>",
+		},
+		{
+			name:  "generated plist",
+			major: "5",
+			files: map[string]string{
+				"Versions/5/QtCore": "binary",
+			},
+			plist: "<string>org.qt-project.QtCore</string>",
+		},
+	}
+	for _, tt := range tests {
+		qt := qtInfo{Version: tt.major + ".2.0", Major: tt.major}
+		version := qt.FrameworkVersion()
+		orig := filepath.Join(t.TempDir(), "QtCore.framework")
+		writeFiles(t, orig, tt.files)
+		targ := filepath.Join(t.TempDir(), "QtCore.framework")
+
+		binary, err := copyFramework(orig, targ, qt)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if want := filepath.Join(targ, "Versions", version, "QtCore"); binary != want {
+			t.Errorf("%s: binary %s, want %s", tt.name, binary, want)
+		}
+		if fi, err := os.Stat(binary); err != nil || fi.Mode().Perm() != 0755 {
+			t.Errorf("%s: binary not executable: %v", tt.name, err)
+		}
+		links := map[string]string{
+			"Versions/Current": version,
+			"QtCore":           "Versions/Current/QtCore",
+			"Resources":        "Versions/Current/Resources",
+		}
+		for name, want := range links {
+			got, err := os.Readlink(filepath.Join(targ, filepath.FromSlash(name)))
+			if err != nil || filepath.ToSlash(got) != want {
+				t.Errorf("%s: link %s -> %s (%v), want %s", tt.name, name, got, err, want)
+			}
+		}
+		// resolved through the links like the loader does
+		if buf, err := ioutil.ReadFile(filepath.Join(targ, "QtCore")); err != nil || string(buf) != "binary" {
+			t.Errorf("%s: QtCore: %q, %v", tt.name, buf, err)
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(targ, "Resources", "Info.plist"))
+		if err != nil || !strings.Contains(string(buf), tt.plist) {
+			t.Errorf("%s: Info.plist %q (%v), want %s in it", tt.name, buf, err, tt.plist)
+		}
+		for _, name := range []string{"Headers", "QtCore_debug", "Contents"} {
+			for _, dir := range []string{targ, filepath.Join(targ, "Versions", version)} {
+				if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+					t.Errorf("%s: %s copied", tt.name, filepath.Join(dir, name))
+				}
+			}
+		}
+	}
+}
+
+func TestReleaseCheck(t *testing.T) {
+	tests := []struct {
+		version string
+		short   string
+		ok      bool
+	}{
+		{"v1.2.3-4-gdeadbeef-dirty", "1.2.3", true},
+		{"1.2.3.4", "1.2.3.4", true},
+		{"65535.0", "65535.0", true},
+		{"0.0.0-dev", "0.0.0", true},
+		{"nightly", "0.0.0", true},
+		{"1.2.3.4.5", "1.2.3.4.5", false},
+		{"1.65536", "1.65536", false},
+		{"1.0 beta", "1.0", false},
+		{"1.0'", "1.0", false},
+		{`1.0"`, "1.0", false},
+		{"1.0\x00", "1.0", false},
+	}
+	for _, tt := range tests {
+		r := releaseInfo{Version: tt.version}
+		if short := r.Short(); short != tt.short {
+			t.Errorf("%q: got short %s, want %s", tt.version, short, tt.short)
+		}
+		if err := r.check(); (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v, want ok %v", tt.version, err, tt.ok)
+		}
+	}
+	if _, err := getReleaseInfo(newRunner(&Config{}), pkgInfo{}, "1.0 beta", &deployProfile{}); err == nil {
+		t.Error("getReleaseInfo accepted a version with a space")
+	}
+}
+
+func TestGetReleaseInfoGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("needs git")
+	}
+	dir := t.TempDir()
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_AUTHOR_DATE", "2015-01-02T03:04:05Z")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_DATE", "2015-01-02T03:04:05Z")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"commit", "-q", "--allow-empty", "-m", "init"},
+		{"tag", "v1.2.3"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	// the test runs in another dir, git must describe the package one
+	info, err := getReleaseInfo(newRunner(&Config{}), pkgInfo{Dir: dir}, "", &deployProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v1.2.3" {
+		t.Errorf("got version %s, want v1.2.3", info.Version)
+	}
+	if len(info.Commit) != 40 {
+		t.Errorf("got commit %q", info.Commit)
+	}
+	if want := "2015-01-02T03:04:05Z"; info.Date != want {
+		t.Errorf("got date %s, want %s", info.Date, want)
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	r := newRunner(&Config{Timeout: 100 * time.Millisecond})
+	r.waitDelay = 100 * time.Millisecond
+
+	// the grandchild holds stdout and stderr open after sh is killed
+	start := time.Now()
+	_, err := r.run(exec.Command("sh", "-c", "sleep 60 & wait"))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got error %v, want timeout", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("run returned after %v", d)
+	}
+}
+
+func TestGoBuildTrimpath(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name     string
+		profile  *bool
+		flag     *bool
+		trimpath bool
+	}{
+		{"default", nil, nil, true},
+		{"profile", &no, nil, false},
+		{"flag", &no, &yes, true},
+	}
+	for _, tt := range tests {
+		build := BuildOptions{Trimpath: tt.profile}
+		build.override(BuildOptions{Trimpath: tt.flag})
+		cfg := &config{Profile: deployProfile{Build: build}}
+		cmd := goBuildCmd(cfg, pkgInfo{Name: "app"}, "app")
+		var trimpath bool
+		for _, arg := range cmd.Args {
+			trimpath = trimpath || arg == "-trimpath"
+		}
+		if trimpath != tt.trimpath {
+			t.Errorf("%s: got -trimpath %v in %v", tt.name, trimpath, cmd.Args)
+		}
+	}
+}
+
+func TestExecName(t *testing.T) {
+	tests := []struct {
+		path, name string
+	}{
+		{"example.com/hello", "hello"},
+		{"example.com/hello/v2", "hello"},
+		{"example.com/hello/v10", "hello"},
+		{"example.com/hello/v1", "v1"},
+		{"example.com/hello/v0", "v0"},
+		{"example.com/hello/v2x", "v2x"},
+		{"gopkg.in/hello.v2", "hello.v2"},
+		{"v2", "v2"},
+	}
+	for _, tt := range tests {
+		if name := execName(tt.path); name != tt.name {
+			t.Errorf("%s: got %s, want %s", tt.path, name, tt.name)
+		}
+	}
+}
+
+func TestGetPkgInfo(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":              "module example.com/hello/v2\n",
+		"project/main.qml":    "",
+		"cmd/hello/main.go":   "package main\n\nfunc main() {}\n",
+		"internal/lib/lib.go": "package lib\n",
+	})
+	dir := filepath.Join(root, "cmd", "hello")
+	info, err := getPkgInfo(newRunner(&Config{}), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "hello" || info.ImportPath != "example.com/hello/v2/cmd/hello" {
+		t.Errorf("got package %s (%s)", info.Name, info.ImportPath)
+	}
+	if !samePath(info.Dir, dir) || !samePath(info.Root, root) || !samePath(info.Base, root) {
+		t.Errorf("got dir %s, root %s, base %s", info.Dir, info.Root, info.Base)
+	}
+	if _, err = getPkgInfo(newRunner(&Config{}), filepath.Join(root, "internal", "lib")); err == nil {
+		t.Error("a non-main package is accepted")
+	}
+
+	// defaults are resolved against the project, not the current dir
+	var cfg Config
+	if name := cfg.profile(info); !samePath(name, filepath.Join(root, "deploy_profile.yaml")) {
+		t.Errorf("got profile %s", name)
+	}
+	if name := cfg.outDir(info); !samePath(name, filepath.Join(root, "out")) {
+		t.Errorf("got out dir %s", name)
+	}
+	cfg = Config{Profile: "custom.yaml", OutDir: "dist"}
+	if cfg.profile(info) != "custom.yaml" || cfg.outDir(info) != "dist" {
+		t.Errorf("got profile %s, out dir %s", cfg.profile(info), cfg.outDir(info))
+	}
+}
+
+func TestPlanLayoutGOOSSection(t *testing.T) {
+	const name = "embedded-test"
+	linux, _ := LookupTarget("linux")
+	RegisterTarget(name, Target{GOOS: "linux", Layout: linux.Layout, New: linux.New})
+	defer delete(deployTargets, name)
+
+	cfg := testConfig(t, "5")
+	cfg.Profile.Extra = map[string][]string{"linux": {"libfoo.so"}}
+	want, err := planLayout(cfg, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := planLayout(cfg, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{"libs", "plugins", "extra"} {
+		if !reflect.DeepEqual(planned(got, kind), planned(want, kind)) {
+			t.Errorf("%s: got %v, want the linux ones %v", kind, planned(got, kind), planned(want, kind))
+		}
+	}
+	if plugins := planned(got, "plugins"); !strings.Contains(strings.Join(plugins, " "), "xcb") {
+		t.Errorf("no xcb among plugins %v", plugins)
+	}
+
+	// a section of the target itself takes precedence
+	cfg.Profile.Libs[name] = []string{"QtSql"}
+	cfg.Profile.Plugins[name] = map[string][]string{"platforms": {"eglfs"}}
+	got, err = planLayout(cfg, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs := planned(got, "libs")
+	if last := libs[len(libs)-1]; !strings.Contains(last, "Sql") || len(libs) != len(cfg.Profile.Libs["default"])+1 {
+		t.Errorf("got libs %v", libs)
+	}
+	if plugins := strings.Join(planned(got, "plugins"), " "); !strings.Contains(plugins, "eglfs") || strings.Contains(plugins, "xcb") {
+		t.Errorf("got plugins %s", plugins)
+	}
+}
+
+func TestProfilePlugins(t *testing.T) {
+	const name = "embedded-plugins"
+	linux, _ := LookupTarget("linux")
+	RegisterTarget(name, Target{GOOS: "linux", Layout: linux.Layout, New: linux.New})
+	defer delete(deployTargets, name)
+
+	tests := []struct {
+		name    string
+		profile deployProfile
+		target  string
+		want    map[string][]string
+	}{
+		{
+			name: "default and target sections",
+			profile: deployProfile{Plugins: map[string]map[string][]string{
+				"default": {"imageformats": {"gif", "jpeg"}, "sqldrivers": {}},
+				"linux":   {"imageformats": {"jpeg", "svg"}, "platforms": {"xcb"}},
+				"windows": {"platforms": {"windows"}},
+			}},
+			target: "linux",
+			want: map[string][]string{
+				"imageformats": {"gif", "jpeg", "svg"},
+				"platforms":    {"xcb"},
+				"sqldrivers":   {},
+			},
+		},
+		{
+			name: "aliases",
+			profile: deployProfile{
+				Plugins: map[string]map[string][]string{
+					"default": {"imageformats": {"gif"}},
+				},
+				Platforms:    map[string][]string{"darwin": {"cocoa"}, "linux": {"xcb"}},
+				Imageformats: []string{"gif", "ico"},
+			},
+			target: "darwin",
+			want: map[string][]string{
+				"imageformats": {"gif", "ico"},
+				"platforms":    {"cocoa"},
+			},
+		},
+		{
+			name: "GOOS fallback",
+			profile: deployProfile{
+				Plugins: map[string]map[string][]string{
+					"linux": {"platforms": {"xcb"}},
+				},
+				Platforms: map[string][]string{"linux": {"offscreen"}},
+			},
+			target: name,
+			want:   map[string][]string{"platforms": {"xcb", "offscreen"}},
+		},
+		{
+			name: "own section",
+			profile: deployProfile{
+				Plugins: map[string]map[string][]string{
+					"linux": {"platforms": {"xcb"}},
+					name:    {"platforms": {"eglfs"}},
+				},
+				Platforms: map[string][]string{"linux": {"offscreen"}},
+			},
+			target: name,
+			want:   map[string][]string{"platforms": {"eglfs", "offscreen"}},
+		},
+		{
+			name:    "no plugins",
+			profile: deployProfile{},
+			target:  "windows",
+			want:    map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.profile.plugins(tt.target); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteQtConf(t *testing.T) {
+	qtconf := map[string]map[string]map[string]string{
+		"default": {"Platforms": {"FontEngine": "freetype"}},
+		"windows": {
+			"Platforms": {"WindowsArguments": "dpiawareness=1"},
+			"Paths":     {"Prefix": "runtime"},
+		},
+	}
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"darwin", "[Paths]\n" +
+			"Imports = Resources/qml\n" +
+			"Libraries = Frameworks\n" +
+			"Plugins = Plugins\n" +
+			"Prefix = .\n" +
+			"Qml2Imports = Resources/qml\n" +
+			"Translations = Resources/translations\n" +
+			"\n[Platforms]\n" +
+			"FontEngine = freetype\n"},
+		{"linux", "[Paths]\n" +
+			"Imports = qml\n" +
+			"Libraries = .\n" +
+			"Plugins = .\n" +
+			"Prefix = .\n" +
+			"Qml2Imports = qml\n" +
+			"Translations = translations\n" +
+			"\n[Platforms]\n" +
+			"FontEngine = freetype\n"},
+		// keys of the target section are merged over the default and generated ones
+		{"windows", "[Paths]\n" +
+			"Imports = qml\n" +
+			"Libraries = .\n" +
+			"Plugins = .\n" +
+			"Prefix = runtime\n" +
+			"Qml2Imports = qml\n" +
+			"Translations = translations\n" +
+			"\n[Platforms]\n" +
+			"FontEngine = freetype\n" +
+			"WindowsArguments = dpiawareness=1\n"},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, "5")
+		cfg.Profile.QtConf = qtconf
+		layout := cfg.Profile.layout(tt.target)
+		root := t.TempDir()
+		if err := writeQtConf(cfg, tt.target, layout, root); err != nil {
+			t.Errorf("%s: %v", tt.target, err)
+			continue
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(layout.Conf)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.target, err)
+			continue
+		}
+		if string(buf) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.target, buf, tt.want)
+		}
+	}
+}
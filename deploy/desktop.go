@@ -0,0 +1,315 @@
+// desktop.go — Linux desktop integration, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// hicolorSizes are the sizes of icons put into the hicolor theme.
+var hicolorSizes = []int{16, 22, 24, 32, 48, 64, 128, 256, 512}
+
+// desktopProfile describes the freedesktop.org integration of the app,
+// the .desktop entry and the AppStream metainfo are generated from it.
+type desktopProfile struct {
+	ID              string // reverse-DNS app id, defaults to the reversed import path
+	Name            string
+	GenericName     string
+	Comment         string
+	Categories      []string
+	MimeTypes       []string
+	Keywords        []string
+	Terminal        bool
+	Summary         string
+	Description     []string // paragraphs
+	MetadataLicense string
+	ProjectLicense  string
+	Homepage        string
+	Developer       string
+	Prefix          string // dir the package is installed to, /opt/<app> by default
+}
+
+// desktopEntry is a group of the .desktop file, keys keep their order.
+type desktopEntry [][2]string
+
+// writeDesktopFiles generates the desktop entry, hicolor icons and AppStream metainfo
+// under share dir of the package:
+//
+//     share/applications/<id>.desktop
+//     share/icons/hicolor/<size>x<size>/apps/<id>.png
+//     share/metainfo/<id>.metainfo.xml
+//
+// The entry runs launcher (relative to root) from the dir the package is installed to,
+// the launcher sets LD_LIBRARY_PATH so the bundled Qt is used.
+func writeDesktopFiles(cfg *config, root, launcher string) (err error) {
+	desktop := cfg.Profile.Desktop
+	id := desktop.ID
+	if len(id) < 1 {
+		id = bundleIdentifier(cfg.PkgInfo.ImportPath)
+	}
+	if !validBundleIdentifier(id) {
+		return fmt.Errorf("desktop: invalid id: %s", id)
+	}
+	name := desktop.Name
+	if len(name) < 1 {
+		name = cfg.PkgInfo.Name
+	}
+	share := filepath.Join(root, "share")
+
+	// icons
+	var icon string
+	if len(cfg.Profile.Icon) > 0 {
+		img, err := readPNG(cfg.Profile.Icon)
+		if err != nil {
+			return fmt.Errorf("icon: %v", err)
+		}
+		for _, size := range hicolorSizes {
+			dir := filepath.Join(share, "icons", "hicolor", fmt.Sprintf("%dx%d", size, size), "apps")
+			if err = os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			if err = png.Encode(&buf, resizeImage(img, size)); err != nil {
+				return err
+			}
+			if err = ioutil.WriteFile(filepath.Join(dir, id+".png"), buf.Bytes(), 0666); err != nil {
+				return err
+			}
+		}
+		icon = id
+	}
+
+	// desktop entry
+	prefix := desktop.Prefix
+	if len(prefix) < 1 {
+		prefix = "/opt/" + cfg.PkgInfo.Name
+	}
+	tryExec := path.Join(prefix, filepath.ToSlash(launcher))
+	exec := desktopQuote(tryExec)
+	if len(desktop.MimeTypes) > 0 {
+		exec += " %F"
+	}
+	entry := desktopEntry{
+		{"Type", "Application"},
+		{"Version", "1.0"},
+		{"Name", desktopEscape(name)},
+	}
+	entry = entry.add("GenericName", desktopEscape(desktop.GenericName))
+	entry = entry.add("Comment", desktopEscape(desktop.Comment))
+	entry = append(entry, [2]string{"TryExec", desktopEscape(tryExec)})
+	entry = append(entry, [2]string{"Exec", desktopEscape(exec)})
+	entry = entry.add("Icon", icon)
+	entry = append(entry, [2]string{"Terminal", fmt.Sprint(desktop.Terminal)})
+	entry = entry.add("Categories", desktopList(desktop.Categories))
+	entry = entry.add("MimeType", desktopList(desktop.MimeTypes))
+	entry = entry.add("Keywords", desktopList(desktop.Keywords))
+	if err = entry.validate(); err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("[Desktop Entry]\n")
+	for _, kv := range entry {
+		fmt.Fprintf(&buf, "%s=%s\n", kv[0], kv[1])
+	}
+	dir := filepath.Join(share, "applications")
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, id+".desktop"), buf.Bytes(), 0666); err != nil {
+		return
+	}
+
+	// metainfo
+	info := appStreamComponent{
+		Type:            "desktop-application",
+		ID:              id,
+		MetadataLicense: desktop.MetadataLicense,
+		ProjectLicense:  desktop.ProjectLicense,
+		Name:            name,
+		Summary:         desktop.Summary,
+		Developer:       desktop.Developer,
+		Launchable:      appStreamLaunchable{Type: "desktop-id", ID: id + ".desktop"},
+	}
+	if len(info.MetadataLicense) < 1 {
+		info.MetadataLicense = "CC0-1.0"
+	}
+	if len(info.Summary) < 1 {
+		info.Summary = desktop.Comment
+	}
+	if len(info.Summary) < 1 {
+		info.Summary = name
+	}
+	info.Description.Paragraphs = desktop.Description
+	if len(info.Description.Paragraphs) < 1 {
+		info.Description.Paragraphs = []string{info.Summary}
+	}
+	if len(desktop.Homepage) > 0 {
+		info.URLs = append(info.URLs, appStreamURL{Type: "homepage", URL: desktop.Homepage})
+	}
+	info.Releases.Releases = []appStreamRelease{{
+		Version: cfg.Release.Version,
+		Date:    strings.SplitN(cfg.Release.Date, "T", 2)[0],
+	}}
+	if len(desktop.MimeTypes) > 0 {
+		info.Provides = &appStreamProvides{MimeTypes: desktop.MimeTypes}
+	}
+	if len(desktop.Categories) > 0 {
+		info.Categories = &appStreamCategories{Categories: desktop.Categories}
+	}
+	if err = info.validate(); err != nil {
+		return
+	}
+	data, err := xml.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return
+	}
+	dir = filepath.Join(share, "metainfo")
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	return ioutil.WriteFile(filepath.Join(dir, id+".metainfo.xml"), data, 0666)
+}
+
+func (e desktopEntry) add(key, val string) desktopEntry {
+	if len(val) < 1 {
+		return e
+	}
+	return append(e, [2]string{key, val})
+}
+
+// validate checks the keys required by the Desktop Entry Specification.
+func (e desktopEntry) validate() error {
+	keys := make(map[string]string, len(e))
+	for _, kv := range e {
+		keys[kv[0]] = kv[1]
+	}
+	for _, key := range []string{"Type", "Name", "Exec"} {
+		if len(keys[key]) < 1 {
+			return fmt.Errorf("desktop: entry has no %s key", key)
+		}
+	}
+	return nil
+}
+
+// desktopEscape escapes a value of string type.
+func desktopEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s)
+}
+
+// desktopQuote quotes an argument of the Exec key if it has reserved chars,
+// percent signs are doubled not to be taken for field codes.
+func desktopQuote(arg string) string {
+	arg = strings.Replace(arg, "%", "%%", -1)
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`"`, `\"`, "`", "\\`", "$", `\$`, `\`, `\\`).Replace(arg) + `"`
+}
+
+// desktopList formats a list of strings, each item is terminated by semicolon.
+func desktopList(list []string) string {
+	var buf bytes.Buffer
+	for _, item := range list {
+		buf.WriteString(strings.Replace(desktopEscape(item), ";", `\;`, -1))
+		buf.WriteString(";")
+	}
+	return buf.String()
+}
+
+// appStreamComponent is the root of AppStream metainfo file.
+type appStreamComponent struct {
+	XMLName         xml.Name             `xml:"component"`
+	Type            string               `xml:"type,attr"`
+	ID              string               `xml:"id"`
+	MetadataLicense string               `xml:"metadata_license"`
+	ProjectLicense  string               `xml:"project_license,omitempty"`
+	Name            string               `xml:"name"`
+	Summary         string               `xml:"summary"`
+	Developer       string               `xml:"developer_name,omitempty"`
+	Description     appStreamDescription `xml:"description"`
+	Launchable      appStreamLaunchable  `xml:"launchable"`
+	URLs            []appStreamURL       `xml:"url"`
+	Categories      *appStreamCategories `xml:"categories"`
+	Provides        *appStreamProvides   `xml:"provides"`
+	Releases        appStreamReleases    `xml:"releases"`
+}
+
+type appStreamDescription struct {
+	Paragraphs []string `xml:"p"`
+}
+
+type appStreamLaunchable struct {
+	Type string `xml:"type,attr"`
+	ID   string `xml:",chardata"`
+}
+
+type appStreamURL struct {
+	Type string `xml:"type,attr"`
+	URL  string `xml:",chardata"`
+}
+
+type appStreamCategories struct {
+	Categories []string `xml:"category"`
+}
+
+type appStreamReleases struct {
+	Releases []appStreamRelease `xml:"release"`
+}
+
+type appStreamRelease struct {
+	Version string `xml:"version,attr"`
+	Date    string `xml:"date,attr,omitempty"`
+}
+
+type appStreamProvides struct {
+	MimeTypes []string `xml:"mediatype"`
+}
+
+// validate checks the tags required by AppStream for desktop applications.
+func (c appStreamComponent) validate() error {
+	for _, tag := range [][2]string{
+		{"id", c.ID},
+		{"metadata_license", c.MetadataLicense},
+		{"name", c.Name},
+		{"summary", c.Summary},
+		{"launchable", c.Launchable.ID},
+	} {
+		if len(tag[1]) < 1 {
+			return fmt.Errorf("metainfo: no %s", tag[0])
+		}
+	}
+	if len(c.Description.Paragraphs) < 1 {
+		return fmt.Errorf("metainfo: no description")
+	}
+	return nil
+}
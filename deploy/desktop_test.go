@@ -0,0 +1,221 @@
+// desktop_test.go — tests of the freedesktop integration, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readDesktopEntry parses the [Desktop Entry] group of a .desktop file.
+func readDesktopEntry(t *testing.T, name string) map[string]string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if lines[0] != "[Desktop Entry]" {
+		t.Fatalf("%s: group header is %q", name, lines[0])
+	}
+	entry := make(map[string]string)
+	for _, line := range lines[1:] {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			t.Fatalf("%s: malformed line %q", name, line)
+		}
+		if _, ok := entry[kv[0]]; ok {
+			t.Fatalf("%s: duplicate key %s", name, kv[0])
+		}
+		entry[kv[0]] = kv[1]
+	}
+	return entry
+}
+
+func TestWriteDesktopFiles(t *testing.T) {
+	icon := filepath.Join(t.TempDir(), "icon.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(64)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(icon, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		desktop desktopProfile
+		icon    string
+		entry   map[string]string
+		id      string
+		err     string
+	}{
+		{
+			name: "defaults",
+			entry: map[string]string{
+				"Type":     "Application",
+				"Version":  "1.0",
+				"Name":     "app",
+				"TryExec":  "/opt/app/app.sh",
+				"Exec":     "/opt/app/app.sh",
+				"Terminal": "false",
+			},
+			id: "com.example.app",
+		},
+		{
+			name: "full",
+			desktop: desktopProfile{
+				ID:          "org.example.Hello",
+				Name:        "Hello",
+				GenericName: "Greeter",
+				Comment:     "Says hello",
+				Categories:  []string{"Utility"},
+				MimeTypes:   []string{"text/plain"},
+				Keywords:    []string{"hello", "world"},
+				Description: []string{"Hello is a hello world."},
+				Homepage:    "https://example.com",
+				Prefix:      "/usr/local/lib/hello",
+			},
+			icon: icon,
+			entry: map[string]string{
+				"Type":        "Application",
+				"Version":     "1.0",
+				"Name":        "Hello",
+				"GenericName": "Greeter",
+				"Comment":     "Says hello",
+				"TryExec":     "/usr/local/lib/hello/app.sh",
+				"Exec":        "/usr/local/lib/hello/app.sh %F",
+				"Icon":        "org.example.Hello",
+				"Terminal":    "false",
+				"Categories":  "Utility;",
+				"MimeType":    "text/plain;",
+				"Keywords":    "hello;world;",
+			},
+			id: "org.example.Hello",
+		},
+		{
+			name:    "quoted",
+			desktop: desktopProfile{Prefix: "/opt/My App 100%"},
+			entry: map[string]string{
+				"Type":     "Application",
+				"Version":  "1.0",
+				"Name":     "app",
+				"TryExec":  "/opt/My App 100%/app.sh",
+				"Exec":     `"/opt/My App 100%%/app.sh"`,
+				"Terminal": "false",
+			},
+			id: "com.example.app",
+		},
+		{
+			name:    "invalid id",
+			desktop: desktopProfile{ID: "not an id"},
+			err:     "desktop: invalid id",
+		},
+	}
+	for _, tt := range tests {
+		cfg := &config{
+			PkgInfo: pkgInfo{Name: "app", ImportPath: "example.com/app"},
+			Release: releaseInfo{Version: "1.2.3", Date: "2014-06-01T12:00:00Z"},
+		}
+		cfg.Profile.Desktop = tt.desktop
+		cfg.Profile.Icon = tt.icon
+		root := t.TempDir()
+		err := writeDesktopFiles(cfg, root, "app.sh")
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		share := filepath.Join(root, "share")
+
+		entry := readDesktopEntry(t, filepath.Join(share, "applications", tt.id+".desktop"))
+		if !reflect.DeepEqual(entry, tt.entry) {
+			t.Errorf("%s: got entry %v, want %v", tt.name, entry, tt.entry)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(share, "metainfo", tt.id+".metainfo.xml"))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var info appStreamComponent
+		if err = xml.Unmarshal(data, &info); err != nil {
+			t.Errorf("%s: metainfo: %v", tt.name, err)
+			continue
+		}
+		if err = info.validate(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if info.Type != "desktop-application" || info.ID != tt.id || info.Name != tt.entry["Name"] {
+			t.Errorf("%s: got component %s %s %q", tt.name, info.Type, info.ID, info.Name)
+		}
+		launchable := appStreamLaunchable{Type: "desktop-id", ID: tt.id + ".desktop"}
+		if info.Launchable != launchable {
+			t.Errorf("%s: got launchable %v, want %v", tt.name, info.Launchable, launchable)
+		}
+		if len(info.Description.Paragraphs) < 1 {
+			t.Errorf("%s: metainfo has no description", tt.name)
+		}
+		if len(info.Releases.Releases) != 1 || info.Releases.Releases[0] != (appStreamRelease{"1.2.3", "2014-06-01"}) {
+			t.Errorf("%s: got releases %v", tt.name, info.Releases.Releases)
+		}
+
+		for _, size := range hicolorSizes {
+			name := filepath.Join(share, "icons", "hicolor", fmt.Sprintf("%dx%d", size, size), "apps", tt.id+".png")
+			f, err := os.Open(name)
+			if len(tt.icon) < 1 {
+				if err == nil {
+					f.Close()
+					t.Errorf("%s: unexpected icon %s", tt.name, name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			img, err := png.Decode(f)
+			f.Close()
+			if err != nil {
+				t.Errorf("%s: %s: %v", tt.name, name, err)
+				continue
+			}
+			if b := img.Bounds(); b.Dx() != size || b.Dy() != size {
+				t.Errorf("%s: icon %d is %v", tt.name, size, b)
+			}
+		}
+	}
+}
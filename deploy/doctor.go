@@ -0,0 +1,365 @@
+// doctor.go — checks of the tools and Qt the deployment relies on, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+// CheckStatus is the outcome of a check.
+type CheckStatus int
+
+const (
+	Pass CheckStatus = iota
+	Warn
+	Fail
+)
+
+func (s CheckStatus) String() string {
+	return [...]string{"PASS", "WARN", "FAIL"}[s]
+}
+
+// Check is a single row of the doctor report, Fix suggests what to do
+// unless the check passed.
+type Check struct {
+	Status CheckStatus
+	Name   string
+	Detail string
+	Fix    string
+}
+
+// doctor collects check results, the package and the Qt found are kept for checks
+// that depend on them.
+type doctor struct {
+	*runner
+	results     []Check
+	pkg         string
+	pkgInfo     pkgInfo
+	pkgErr      error
+	target      string
+	profileName string
+	profile     deployProfile
+	qt          qtInfo
+	qtFound     bool
+}
+
+func (d *doctor) pass(name, detail string) {
+	d.results = append(d.results, Check{Pass, name, detail, ""})
+}
+
+func (d *doctor) warn(name, detail, fix string) {
+	d.results = append(d.results, Check{Warn, name, detail, fix})
+}
+
+func (d *doctor) fail(name, detail, fix string) {
+	d.results = append(d.results, Check{Fail, name, detail, fix})
+}
+
+// Doctor checks every external tool the deployment runs and their versions, makes
+// sure qmake, qtpaths and pkg-config refer to the same Qt install and that each
+// lib, plugin and module listed in the profile exists in it.
+func Doctor(cfg Config) []Check {
+	d := &doctor{runner: newRunner(&cfg), pkg: cfg.pkg()}
+	// the default profile is the one of the project, not of the current dir
+	d.pkgInfo, d.pkgErr = getPkgInfo(d.runner, d.pkg)
+	d.profileName = cfg.profile(d.pkgInfo)
+	if target, err := getTarget(cfg.Target); err != nil {
+		d.fail("target", err.Error(), "choose one of the registered targets")
+	} else {
+		d.target = target
+	}
+
+	d.checkGo()
+	d.checkProfile()
+	d.checkQmake()
+	d.checkQtpaths()
+	d.checkPkgConfig()
+	d.checkTool("rice", nil, "go get github.com/GeertJohan/go.rice/rice", true)
+	if runtime.GOOS == "darwin" {
+		d.checkTool("install_name_tool", []string{"-V"},
+			"install Xcode command line tools: xcode-select --install", true)
+		d.checkTool("hdiutil", []string{"version"}, "needed by --dmg only, it comes with OS X", false)
+	}
+	if len(d.profile.Version) < 1 {
+		d.checkTool("git", []string{"--version"},
+			"install git or set version in "+d.profileName+", 0.0.0-dev is used otherwise", false)
+	}
+	d.checkEntries()
+	return d.results
+}
+
+// WriteReport prints checks as a table and returns the number of failures.
+func WriteReport(w io.Writer, checks []Check) (failed int) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Status, c.Name, c.Detail)
+		if len(c.Fix) > 0 {
+			fmt.Fprintf(tw, "\t\tfix: %s\n", c.Fix)
+		}
+		if c.Status == Fail {
+			failed++
+		}
+	}
+	tw.Flush()
+	return
+}
+
+func (d *doctor) checkGo() {
+	buf, err := d.run(exec.Command("go", "version"))
+	if err != nil {
+		d.fail("go", firstLine(err.Error()), "install Go from https://golang.org/dl and add it to $PATH")
+		return
+	}
+	d.pass("go", strings.TrimPrefix(firstLine(string(buf)), "go version "))
+}
+
+func (d *doctor) checkProfile() {
+	profile, err := readProfile(d.profileName)
+	switch {
+	case os.IsNotExist(err):
+		d.fail("profile", d.profileName+" not found",
+			"run doctor from the project dir or copy deploy_profile.yaml from the kit")
+	case err != nil:
+		d.fail("profile", err.Error(), "fix the syntax of "+d.profileName)
+	default:
+		d.profile = profile
+		d.pass("profile", d.profileName)
+	}
+}
+
+func (d *doctor) checkQmake() {
+	qt, err := getQtInfo(d.runner, &d.profile)
+	if err != nil {
+		d.fail("qmake", firstLine(err.Error()),
+			"add the bin dir of Qt to $PATH, set $QMLKIT_QMAKE or qmake in "+d.profileName)
+		return
+	}
+	d.qt, d.qtFound = qt, true
+	d.pass("qmake", fmt.Sprintf("Qt %s at %s (%s)", qt.Version, qt.BasePath, qt.Qmake))
+}
+
+// checkQtpaths makes sure qtpaths found in $PATH belongs to the Qt qmake reports,
+// Qt tools mixed from different installs is a common source of confusion.
+func (d *doctor) checkQtpaths() {
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	var path string
+	for _, name := range []string{"qtpaths", "qtpaths6"} {
+		if p, err := exec.LookPath(name + exe); err == nil {
+			path = p
+			break
+		}
+	}
+	if len(path) < 1 {
+		d.warn("qtpaths", "not found", "optional, it comes with Qt tools")
+		return
+	}
+	buf, err := d.run(exec.Command(path, "--qt-version"))
+	if err != nil {
+		d.warn("qtpaths", firstLine(err.Error()), "make sure "+path+" is a working Qt tool")
+		return
+	}
+	version := firstLine(string(buf))
+	if !d.qtFound {
+		d.pass("qtpaths", fmt.Sprintf("Qt %s (%s)", version, path))
+		return
+	}
+	buf, err = d.run(exec.Command(path, "--plugin-dir"))
+	if err != nil {
+		d.warn("qtpaths", firstLine(err.Error()), "make sure "+path+" is a working Qt tool")
+		return
+	}
+	if plugins := firstLine(string(buf)); !samePath(plugins, d.qt.PluginPath) {
+		d.fail("qtpaths", fmt.Sprintf("%s belongs to Qt %s with plugins in %s, qmake uses %s",
+			path, version, plugins, d.qt.PluginPath),
+			"put "+d.qt.BinPath+" first in $PATH")
+		return
+	}
+	d.pass("qtpaths", fmt.Sprintf("Qt %s (%s)", version, path))
+}
+
+// checkPkgConfig runs pkg-config with the same environment go build gets
+// from the deploy task and compares its QtCore with the one of qmake.
+func (d *doctor) checkPkgConfig() {
+	path, err := exec.LookPath("pkg-config")
+	if err != nil {
+		d.fail("pkg-config", "not found", "install pkg-config, cgo uses it to find Qt")
+		return
+	}
+	buf, err := d.run(exec.Command(path, "--version"))
+	if err != nil {
+		d.fail("pkg-config", firstLine(err.Error()), "reinstall pkg-config")
+		return
+	}
+	version := firstLine(string(buf))
+	if !d.qtFound {
+		d.pass("pkg-config", version)
+		return
+	}
+	env := append(os.Environ(), envList(cgoEnv(d.runner, d.qt))...)
+	module := "Qt" + d.qt.Major + "Core"
+	cmd := exec.Command(path, "--modversion", module)
+	cmd.Env = env
+	buf, err = d.run(cmd)
+	if err != nil {
+		d.warn("pkg-config", module+" not found",
+			"install development files of Qt, "+filepath.Join(d.qt.LibPath, "pkgconfig")+" has no "+module+".pc")
+		return
+	}
+	if modversion := firstLine(string(buf)); modversion != d.qt.Version {
+		d.fail("pkg-config", fmt.Sprintf("%s %s, qmake reports Qt %s", module, modversion, d.qt.Version),
+			"remove other Qt from $PKG_CONFIG_PATH")
+		return
+	}
+	if err := checkPkgConfig(d.runner, env, d.qt); err != nil {
+		d.fail("pkg-config", firstLine(err.Error()), "remove other Qt from $PKG_CONFIG_PATH")
+		return
+	}
+	d.pass("pkg-config", fmt.Sprintf("%s, %s %s", version, module, d.qt.Version))
+}
+
+// checkTool checks that the tool is in $PATH and reports its version, args print
+// the version, nil args mean a Go binary whose module version is read by go version -m.
+// Missing or broken required tools fail the check, a Go tool without build info is
+// only warned about.
+func (d *doctor) checkTool(name string, args []string, fix string, required bool) {
+	report := d.warn
+	if required {
+		report = d.fail
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		report(name, "not found", fix)
+		return
+	}
+	var version string
+	if args == nil {
+		buf, err := d.run(exec.Command("go", "version", "-m", path))
+		if err != nil {
+			// a wrapper script or a binary built without build info may work still
+			d.warn(name, "version unknown, no Go build info ("+path+")", "")
+			return
+		}
+		version = goModVersion(string(buf))
+	} else {
+		buf, err := d.run(exec.Command(path, args...))
+		if err != nil {
+			report(name, firstLine(err.Error()), "reinstall "+name)
+			return
+		}
+		version = firstLine(string(buf))
+	}
+	d.pass(name, fmt.Sprintf("%s (%s)", version, path))
+}
+
+// goModVersion picks the main module version from the output of go version -m,
+// binaries built outside of module mode have none.
+func goModVersion(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "mod" {
+			return fields[2]
+		}
+	}
+	return "unknown version"
+}
+
+// checkEntries makes sure everything the profile lists for this platform
+// can be found, using the same layout rules the deploy task does.
+func (d *doctor) checkEntries() {
+	if !d.qtFound {
+		d.warn("entries", "skipped, no Qt found", "")
+		return
+	}
+	if len(d.target) < 1 {
+		return
+	}
+	if d.pkgErr != nil {
+		d.fail("package", firstLine(d.pkgErr.Error()), "pass the main package or run doctor from its dir")
+		return
+	}
+	pkgInfo := d.pkgInfo
+	bins, err := getBinaries(d.runner, pkgInfo, &d.profile)
+	if err != nil {
+		d.fail("binaries", firstLine(err.Error()), "correct the binaries of "+d.profileName)
+		return
+	}
+	cfg := config{
+		runner:   d.runner,
+		PkgInfo:  primaryBinary(bins).Pkg,
+		Binaries: bins,
+		QtInfo:   d.qt,
+		Profile:  d.profile,
+	}
+	plan, err := planLayout(&cfg, d.target)
+	if err != nil {
+		d.fail("entries", err.Error(), "fix the layout or modules of "+d.profileName)
+		return
+	}
+	missing := 0
+	for _, f := range plan.Files {
+		if _, err := os.Stat(f.Src); err == nil {
+			continue
+		}
+		missing++
+		name := f.Kind
+		if len(f.Name) > 0 {
+			name += " " + f.Name
+		}
+		switch f.Kind {
+		case "qml":
+			d.fail(name, f.Src+" not found", "create it or set layout."+d.target+".qml.src in "+d.profileName)
+		case "extra":
+			d.fail(name, f.Src+" not found", "correct the path in "+d.profileName)
+		default:
+			d.fail(name, f.Src+" not found", "install it with Qt or remove it from "+d.profileName)
+		}
+	}
+	if len(d.profile.Icon) > 0 {
+		icon := pkgInfo.path(d.profile.Icon)
+		if _, err := os.Stat(icon); err != nil {
+			missing++
+			d.fail("icon", icon+" not found", "correct the path in "+d.profileName)
+		}
+	}
+	if missing < 1 {
+		d.pass("entries", fmt.Sprintf("%d found for %s", len(plan.Files), d.target))
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.IndexAny(s, "\r\n"); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
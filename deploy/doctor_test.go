@@ -0,0 +1,108 @@
+// doctor_test.go — tests of the environment checks, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGoModVersion(t *testing.T) {
+	tests := []struct {
+		name, out, version string
+	}{
+		{
+			name: "module",
+			out: "/go/bin/rice: go1.21.0\n" +
+				"\tpath\tgithub.com/GeertJohan/go.rice/rice\n" +
+				"\tmod\tgithub.com/GeertJohan/go.rice\tv1.0.3\th1:abc=\n" +
+				"\tdep\tgithub.com/daaku/go.zipexe\tv1.0.2\th1:def=\n",
+			version: "v1.0.3",
+		},
+		{
+			name:    "devel",
+			out:     "/go/bin/rice: go1.21.0\n\tpath\tgithub.com/GeertJohan/go.rice/rice\n\tmod\tgithub.com/GeertJohan/go.rice\t(devel)\t\n",
+			version: "(devel)",
+		},
+		{
+			name:    "gopath",
+			out:     "/go/bin/rice: go1.10\n",
+			version: "unknown version",
+		},
+	}
+	for _, tt := range tests {
+		if version := goModVersion(tt.out); version != tt.version {
+			t.Errorf("%s: got %q, want %q", tt.name, version, tt.version)
+		}
+	}
+}
+
+func TestCheckTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir := t.TempDir()
+	for name, script := range map[string]string{
+		"hdiutil": "[ \"$1\" = version ] || exit 2\necho 'hdiutil: 671.140.2'\necho 'framework: 671.140.2'\n",
+		"broken":  "echo 'segmentation fault' >&2\nexit 1\n",
+		"wrapper": "exec true\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name     string
+		args     []string
+		required bool
+		status   CheckStatus
+		detail   string
+	}{
+		{"hdiutil", []string{"version"}, false, Pass, "hdiutil: 671.140.2 (" + filepath.Join(dir, "hdiutil") + ")"},
+		{"broken", []string{"--version"}, true, Fail, "exit status 1"},
+		{"broken", []string{"--version"}, false, Warn, "exit status 1"},
+		{"wrapper", nil, true, Warn, "no Go build info"},
+		{"qmlkit-missing-tool", nil, true, Fail, "not found"},
+		{"qmlkit-missing-tool", []string{"--version"}, true, Fail, "not found"},
+		{"qmlkit-missing-tool", []string{"--version"}, false, Warn, "not found"},
+	}
+	for _, tt := range tests {
+		d := &doctor{runner: newRunner(&Config{})}
+		d.checkTool(tt.name, tt.args, "fix it", tt.required)
+		if len(d.results) != 1 {
+			t.Errorf("%s: got %d results", tt.name, len(d.results))
+			continue
+		}
+		c := d.results[0]
+		if c.Status != tt.status || !strings.Contains(c.Detail, tt.detail) {
+			t.Errorf("%s: got %s %q, want %s %q", tt.name, c.Status, c.Detail, tt.status, tt.detail)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// flags.go — options shared by the tasks and the qmlkit command, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files a project created by the Qt Creator wizard or copied from the kit inherits,
+// wizardTask is emitted by the wizard, the others are left when the kit is copied.
+const (
+	wizardTask     = "deploy_task.go"
+	wizardManifest = "wizard.xml"
+	wizardIcon     = "wizard_icon.png"
+	docFile        = "doc.go"
+)
+
+// Flags gives access to parsed options, tasking.T.Flags and the flags
+// of cmd/qmlkit both implement it. Options not defined read as unset.
+type Flags interface {
+	Bool(name string) bool
+	String(name string) string
+}
+
+// FlagConfig fills Config from the options of the deploy, clean and doctor tasks and
+// their optional package argument. Context, Events and Output are left to the caller.
+func FlagConfig(f Flags, args []string) (cfg Config, err error) {
+	if len(args) > 1 {
+		return cfg, fmt.Errorf("too many packages: %s", strings.Join(args, " "))
+	}
+	if len(args) > 0 {
+		cfg.Package = args[0]
+	}
+	cfg.Target = f.String("target")
+	if timeout := f.String("timeout"); len(timeout) > 0 {
+		if cfg.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return cfg, fmt.Errorf("timeout: %v", err)
+		}
+	}
+	cfg.Version = f.String("version")
+	cfg.Dmg = f.Bool("dmg")
+	cfg.Rpath = f.Bool("rpath")
+	cfg.Universal = f.Bool("universal")
+	cfg.Check = f.Bool("check")
+	cfg.KeepFailed = f.Bool("keep-failed")
+	cfg.Build, err = buildFlags(f)
+	return
+}
+
+// buildFlags reads options of `go build`, they override the profile ones.
+func buildFlags(f Flags) (build BuildOptions, err error) {
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	build.Tags = split(f.String("tags"))
+	build.Ldflags = f.String("ldflags")
+	build.Gcflags = f.String("gcflags")
+	if trimpath := f.String("trimpath"); len(trimpath) > 0 {
+		v, err := strconv.ParseBool(trimpath)
+		if err != nil {
+			return build, fmt.Errorf("trimpath: %v", err)
+		}
+		build.Trimpath = &v
+	}
+	build.Buildid = f.String("buildid")
+	build.Race = f.Bool("race")
+	if env := f.String("buildenv"); len(env) > 0 {
+		build.Env = make(map[string]string)
+		for _, kv := range strings.Fields(env) {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 {
+				build.Env[parts[0]] = parts[1]
+			}
+		}
+	}
+	build.Args = strings.Fields(f.String("buildargs"))
+	return
+}
+
+// CleanWizard removes the wizard configs (wizard.xml, wizard_icon.png and doc.go)
+// from the project dir of the package. Nothing is removed unless deploy_task.go,
+// which both the wizard and the kit put there, is found, so doc.go of a project
+// having nothing to do with the kit is kept.
+func CleanWizard(cfg Config) (err error) {
+	pkgInfo, err := getPkgInfo(newRunner(&cfg), cfg.pkg())
+	if err != nil {
+		return
+	}
+	task := filepath.Join(pkgInfo.Base, wizardTask)
+	if _, err = os.Stat(task); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return
+	}
+	for _, name := range []string{wizardIcon, docFile, wizardManifest} {
+		if err = os.Remove(filepath.Join(pkgInfo.Base, name)); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// flags_test.go — tests of the options shared by the tasks, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFlags are parsed options, missing ones read as unset.
+type testFlags map[string]string
+
+func (f testFlags) Bool(name string) bool     { return f[name] == "true" }
+func (f testFlags) String(name string) string { return f[name] }
+
+func TestFlagConfig(t *testing.T) {
+	no := false
+	tests := []struct {
+		name  string
+		flags testFlags
+		args  []string
+		cfg   Config
+		err   string
+	}{
+		{
+			name: "defaults",
+			cfg:  Config{Build: BuildOptions{Tags: []string{}, Args: []string{}}},
+		},
+		{
+			name: "deploy",
+			flags: testFlags{
+				"target":      "linux",
+				"timeout":     "90s",
+				"version":     "1.2.3",
+				"dmg":         "true",
+				"rpath":       "true",
+				"universal":   "true",
+				"check":       "true",
+				"keep-failed": "true",
+				"tags":        "a,b c",
+				"ldflags":     "-s -w",
+				"gcflags":     "-N",
+				"trimpath":    "false",
+				"buildid":     "abc",
+				"race":        "true",
+				"buildenv":    "CGO_ENABLED=1 GOARM=7 junk",
+				"buildargs":   "-v -x",
+			},
+			args: []string{"./cmd/app"},
+			cfg: Config{
+				Package:    "./cmd/app",
+				Target:     "linux",
+				Timeout:    90 * time.Second,
+				Version:    "1.2.3",
+				Dmg:        true,
+				Rpath:      true,
+				Universal:  true,
+				Check:      true,
+				KeepFailed: true,
+				Build: BuildOptions{
+					Tags:     []string{"a", "b", "c"},
+					Ldflags:  "-s -w",
+					Gcflags:  "-N",
+					Trimpath: &no,
+					Buildid:  "abc",
+					Race:     true,
+					Env:      map[string]string{"CGO_ENABLED": "1", "GOARM": "7"},
+					Args:     []string{"-v", "-x"},
+				},
+			},
+		},
+		{
+			name:  "bad timeout",
+			flags: testFlags{"timeout": "soon"},
+			err:   "timeout",
+		},
+		{
+			name:  "bad trimpath",
+			flags: testFlags{"trimpath": "maybe"},
+			err:   "trimpath",
+		},
+		{
+			name: "two packages",
+			args: []string{"./a", "./b"},
+			err:  "too many packages: ./a ./b",
+		},
+	}
+	for _, tt := range tests {
+		if tt.flags == nil {
+			tt.flags = testFlags{}
+		}
+		cfg, err := FlagConfig(tt.flags, tt.args)
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, tt.cfg) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, cfg, tt.cfg)
+		}
+	}
+}
+
+func TestCleanWizard(t *testing.T) {
+	// files the wizard emits, as listed in wizard.xml
+	generated := map[string]string{
+		"main.go":                       "package main\n\nfunc main() {}\n",
+		"deploy_task.go":                "// +build gotask\n\npackage main\n",
+		"doctor_task.go":                "// +build gotask\n\npackage main\n",
+		"deploy_profile.yaml":           "",
+		"README.md":                     "",
+		"project/app.pro":               "",
+		"project/main.cpp":              "",
+		"project/qml/main.qml":          "",
+		"project/images/background.png": "",
+	}
+	// configs left in the project dir when the kit is copied around
+	leftovers := map[string]string{
+		"wizard.xml":      "<wizard/>",
+		"wizard_icon.png": "",
+		"doc.go":          "package main\n",
+	}
+	tests := []struct {
+		name  string
+		files []string // of leftovers
+		task  bool     // deploy_task.go is in the tree
+		left  []string
+	}{
+		{"kit copy", []string{"wizard.xml", "wizard_icon.png", "doc.go"}, true, nil},
+		{"wizard", []string{"wizard_icon.png", "doc.go"}, true, nil},
+		{"wizard clean", nil, true, nil},
+		{"not a kit project", []string{"doc.go", "wizard_icon.png"}, false, []string{"doc.go", "wizard_icon.png"}},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		files := map[string]string{"go.mod": "module example.com/app\n"}
+		for name, data := range generated {
+			if name != "deploy_task.go" || tt.task {
+				files[name] = data
+			}
+		}
+		for _, name := range tt.files {
+			files[name] = leftovers[name]
+		}
+		writeFiles(t, root, files)
+		// the project dir is found from the package, not the current dir
+		if err := CleanWizard(Config{Package: root}); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var left []string
+		for _, name := range []string{"doc.go", "wizard.xml", "wizard_icon.png"} {
+			if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+				left = append(left, name)
+			}
+		}
+		if !reflect.DeepEqual(left, tt.left) {
+			t.Errorf("%s: got %v left, want %v", tt.name, left, tt.left)
+		}
+		for name := range files {
+			if _, ok := leftovers[name]; ok {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// hook.go — hooks run at stages of the deploy pipeline, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Stages of the deploy pipeline hooks may be attached to.
+const (
+	stageBeforeBuild   = "before-build"
+	stageAfterBuild    = "after-build"
+	stageAfterLibs     = "after-libs"
+	stageAfterFinalize = "after-finalize"
+)
+
+var hookStages = []string{stageBeforeBuild, stageAfterBuild, stageAfterLibs, stageAfterFinalize}
+
+// hookFuncs are Go hooks referenced from the profile by name, guarded by targetsMu.
+var hookFuncs = make(map[string]HookFunc)
+
+// HookFunc is a Go hook, a non-nil error aborts the deployment.
+type HookFunc func(meta Metadata) error
+
+// hookProfile is either a shell command (run) or a registered Go func (func),
+// limited to some targets if any listed.
+type hookProfile struct {
+	Run     string
+	Func    string
+	Targets []string
+}
+
+// Metadata describes the deployment to hooks, it is written as JSON for command
+// hooks and $QMLKIT_METADATA points to it. Out is the dir the package is being
+// deployed into (the staging dir), Root is the layout root within it. FinalOut is
+// where the package is moved once deployment succeeds, it doesn't exist while
+// hooks run and holds the previous package if any.
+type Metadata struct {
+	Stage     string   `json:"stage"`
+	Target    string   `json:"target"`
+	Out       string   `json:"out"`
+	Root      string   `json:"root"`
+	FinalOut  string   `json:"finalOut"`
+	App       string   `json:"app"`
+	Binaries  []string `json:"binaries"`
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	Date      string   `json:"date"`
+	QtVersion string   `json:"qtVersion"`
+	QtDir     string   `json:"qtDir"`
+}
+
+// RegisterHook makes a Go func available to the profile as a hook, call it from
+// init() of your own package:
+//
+//     func init() {
+//         deploy.RegisterHook("sign", func(meta deploy.Metadata) error { ... })
+//     }
+func RegisterHook(name string, fn HookFunc) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	if _, ok := hookFuncs[name]; ok {
+		panic("hooks: registered twice: " + name)
+	}
+	hookFuncs[name] = fn
+}
+
+func lookupHook(name string) HookFunc {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	return hookFuncs[name]
+}
+
+// checkHooks validates stages and func names of the profile hooks before
+// anything is built, so a typo doesn't surface at the last stage.
+func checkHooks(profile *deployProfile) error {
+	stages := make([]string, 0, len(profile.Hooks))
+	for stage := range profile.Hooks {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		hooks := profile.Hooks[stage]
+		known := false
+		for _, s := range hookStages {
+			known = known || s == stage
+		}
+		if !known {
+			return fmt.Errorf("deploy: hooks: unknown stage %s, want one of: %s",
+				stage, strings.Join(hookStages, ", "))
+		}
+		for i, hook := range hooks {
+			switch {
+			case len(hook.Run) > 0 && len(hook.Func) > 0:
+				return fmt.Errorf("deploy: hooks: %s #%d: both run and func set", stage, i+1)
+			case len(hook.Run) < 1 && len(hook.Func) < 1:
+				return fmt.Errorf("deploy: hooks: %s #%d: neither run nor func set", stage, i+1)
+			case len(hook.Func) > 0 && lookupHook(hook.Func) == nil:
+				return fmt.Errorf("deploy: hooks: %s #%d: no such func: %s", stage, i+1, hook.Func)
+			}
+		}
+	}
+	return nil
+}
+
+// runHooks runs hooks of the stage in order, the first failure stops the deployment.
+func runHooks(cfg *config, target, stage string) (err error) {
+	var hooks []hookProfile
+	for _, hook := range cfg.Profile.Hooks[stage] {
+		if len(hook.Targets) < 1 || hasString(hook.Targets, target) {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) < 1 {
+		return
+	}
+	layout := cfg.Profile.layout(target)
+	root, err := layout.expand(layout.Root, layoutVars{App: cfg.PkgInfo.Name, Qt: cfg.QtInfo, Release: cfg.Release})
+	if err != nil {
+		return
+	}
+	meta := newMetadata(cfg, target, filepath.Join(cfg.Path, root))
+	meta.Stage = stage
+	for i, hook := range hooks {
+		cfg.emit(Event{Level: Info, Target: target, Stage: stage, Msg: fmt.Sprintf("hook %s #%d", stage, i+1)})
+		if len(hook.Func) > 0 {
+			err = lookupHook(hook.Func)(meta)
+		} else {
+			err = runHookCmd(cfg, meta, hook.Run)
+		}
+		if err != nil {
+			name := hook.Func
+			if len(name) < 1 {
+				name = hook.Run
+			}
+			return fmt.Errorf("deploy [%s]: hook %s #%d (%s): %v", target, stage, i+1, name, err)
+		}
+	}
+	return
+}
+
+// newMetadata describes the deployment, paths are made absolute.
+func newMetadata(cfg *config, target, root string) Metadata {
+	meta := Metadata{
+		Target:    target,
+		Out:       cfg.Path,
+		Root:      root,
+		FinalOut:  cfg.FinalPath,
+		App:       cfg.PkgInfo.Name,
+		Version:   cfg.Release.Version,
+		Commit:    cfg.Release.Commit,
+		Date:      cfg.Release.Date,
+		QtVersion: cfg.QtInfo.Version,
+		QtDir:     cfg.QtInfo.BasePath,
+	}
+	if abs, err := filepath.Abs(meta.Out); err == nil {
+		meta.Out = abs
+	}
+	if abs, err := filepath.Abs(meta.Root); err == nil {
+		meta.Root = abs
+	}
+	if abs, err := filepath.Abs(meta.FinalOut); err == nil && len(meta.FinalOut) > 0 {
+		meta.FinalOut = abs
+	}
+	for _, bin := range cfg.Binaries {
+		meta.Binaries = append(meta.Binaries, bin.Pkg.Name)
+	}
+	return meta
+}
+
+// runHookCmd runs the command with a shell in the base dir of the package, metadata
+// is passed via QMLKIT_* env vars and the JSON file $QMLKIT_METADATA points to.
+func runHookCmd(cfg *config, meta Metadata, run string) (err error) {
+	buf, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return
+	}
+	file, err := ioutil.TempFile("", "qmlkit-hook")
+	if err != nil {
+		return
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.Write(buf); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", run)
+	} else {
+		cmd = exec.Command("sh", "-c", run)
+	}
+	cmd.Dir = cfg.PkgInfo.Base
+	cmd.Env = append(os.Environ(), envList(map[string]string{
+		"QMLKIT_STAGE":      meta.Stage,
+		"QMLKIT_TARGET":     meta.Target,
+		"QMLKIT_OUT":        meta.Out,
+		"QMLKIT_ROOT":       meta.Root,
+		"QMLKIT_FINAL_OUT":  meta.FinalOut,
+		"QMLKIT_APP":        meta.App,
+		"QMLKIT_VERSION":    meta.Version,
+		"QMLKIT_COMMIT":     meta.Commit,
+		"QMLKIT_DATE":       meta.Date,
+		"QMLKIT_QT_VERSION": meta.QtVersion,
+		"QMLKIT_QT_DIR":     meta.QtDir,
+		"QMLKIT_METADATA":   file.Name(),
+	})...)
+	_, err = cfg.run(cmd)
+	return
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+// icon.go — application icon rendering, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+)
+
+// icnsTypes are the icon elements written to .icns files, the @2x variants
+// share pixel sizes with the larger ones but are stored separately.
+var icnsTypes = []struct {
+	Type string
+	Size int
+}{
+	{"icp4", 16},
+	{"ic11", 32}, // 16@2x
+	{"icp5", 32},
+	{"ic12", 64}, // 32@2x
+	{"ic07", 128},
+	{"ic13", 256}, // 128@2x
+	{"ic08", 256},
+	{"ic14", 512}, // 256@2x
+	{"ic09", 512},
+	{"ic10", 1024}, // 512@2x
+}
+
+// readPNG loads the source image of an icon.
+func readPNG(name string) (image.Image, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+// writeIcns renders img in all sizes required by darwin and writes them to w
+// as an .icns file, each element is PNG-compressed. The table of contents
+// lists types and lengths of the elements following it:
+//
+//     'icns' <total length>
+//     'TOC ' <toc length> <type> <element length> ...
+//     <type> <element length> <png data>
+//     ...
+func writeIcns(w io.Writer, img image.Image) error {
+	var toc, body bytes.Buffer
+	rendered := make(map[int][]byte)
+	for _, elem := range icnsTypes {
+		data, ok := rendered[elem.Size]
+		if !ok {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, resizeImage(img, elem.Size)); err != nil {
+				return err
+			}
+			data = buf.Bytes()
+			rendered[elem.Size] = data
+		}
+		for _, b := range []*bytes.Buffer{&toc, &body} {
+			b.WriteString(elem.Type)
+			binary.Write(b, binary.BigEndian, uint32(8+len(data)))
+		}
+		body.Write(data)
+	}
+	var header [16]byte
+	copy(header[:4], "icns")
+	binary.BigEndian.PutUint32(header[4:], uint32(16+toc.Len()+body.Len()))
+	copy(header[8:12], "TOC ")
+	binary.BigEndian.PutUint32(header[12:], uint32(8+toc.Len()))
+	for _, b := range [][]byte{header[:], toc.Bytes(), body.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIcnsFile renders the PNG icon src into the .icns file name.
+func writeIcnsFile(name, src string) error {
+	img, err := readPNG(src)
+	if err != nil {
+		return fmt.Errorf("icon: %v", err)
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := writeIcns(file, img); err != nil {
+		return fmt.Errorf("icon: %v", err)
+	}
+	return file.Close()
+}
+
+// resizeImage scales img to a size×size square using a box filter, pixels are
+// weighted by the area they cover so downscaling does not alias.
+func resizeImage(img image.Image, size int) *image.NRGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	// premultiplied source pixels
+	src := make([][4]float64, sw*sh)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			src[y*sw+x] = [4]float64{float64(r), float64(g), float64(bl), float64(a)}
+		}
+	}
+	// horizontal pass, sw×sh -> size×sh
+	tmp := make([][4]float64, size*sh)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < size; x++ {
+			tmp[y*size+x] = boxSample(size, sw, x, func(i int) [4]float64 {
+				return src[y*sw+i]
+			})
+		}
+	}
+	// vertical pass, size×sh -> size×size
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			px := boxSample(size, sh, y, func(i int) [4]float64 {
+				return tmp[i*size+x]
+			})
+			dst.SetNRGBA(x, y, unpremultiply(px))
+		}
+	}
+	return dst
+}
+
+// boxSample averages source pixels covered by the dst pixel i, where src has n
+// pixels along the axis and dst has size ones.
+func boxSample(size, n, i int, at func(int) [4]float64) (px [4]float64) {
+	scale := float64(n) / float64(size)
+	lo, hi := float64(i)*scale, float64(i+1)*scale
+	var total float64
+	for j := int(lo); j < n && float64(j) < hi; j++ {
+		w := 1.0
+		if float64(j) < lo {
+			w -= lo - float64(j)
+		}
+		if float64(j+1) > hi {
+			w -= float64(j+1) - hi
+		}
+		if w <= 0 {
+			continue
+		}
+		v := at(j)
+		for k := range px {
+			px[k] += v[k] * w
+		}
+		total += w
+	}
+	if total > 0 {
+		for k := range px {
+			px[k] /= total
+		}
+	}
+	return
+}
+
+func unpremultiply(px [4]float64) color.NRGBA {
+	a := px[3]
+	if a <= 0 {
+		return color.NRGBA{}
+	}
+	c := func(v float64) uint8 {
+		v = v / a * 255
+		if v > 255 {
+			v = 255
+		}
+		return uint8(v + 0.5)
+	}
+	return color.NRGBA{c(px[0]), c(px[1]), c(px[2]), uint8(a/257 + 0.5)}
+}
@@ -0,0 +1,130 @@
+// icon_test.go — tests of the icon renderers, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a size×size image, opaque red with a transparent border.
+func testImage(size int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := size / 8; y < size-size/8; y++ {
+		for x := size / 8; x < size-size/8; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	return img
+}
+
+type icnsElem struct {
+	Type string
+	Len  uint32
+}
+
+// readIcns parses an .icns file, elements are read by the table of contents
+// and checked against the element headers.
+func readIcns(t *testing.T, buf []byte) map[string]image.Image {
+	t.Helper()
+	if len(buf) < 16 || string(buf[:4]) != "icns" {
+		t.Fatalf("not an icns file")
+	}
+	if n := binary.BigEndian.Uint32(buf[4:]); int(n) != len(buf) {
+		t.Fatalf("length %d, file has %d bytes", n, len(buf))
+	}
+	if string(buf[8:12]) != "TOC " {
+		t.Fatalf("no table of contents, got %q", buf[8:12])
+	}
+	tocLen := binary.BigEndian.Uint32(buf[12:])
+	var toc []icnsElem
+	for off := 16; off < 8+int(tocLen); off += 8 {
+		toc = append(toc, icnsElem{string(buf[off : off+4]), binary.BigEndian.Uint32(buf[off+4:])})
+	}
+	images := make(map[string]image.Image)
+	off := 8 + int(tocLen)
+	for _, elem := range toc {
+		if off+int(elem.Len) > len(buf) {
+			t.Fatalf("%s: element out of file", elem.Type)
+		}
+		if typ, n := string(buf[off:off+4]), binary.BigEndian.Uint32(buf[off+4:]); typ != elem.Type || n != elem.Len {
+			t.Fatalf("element %s (%d), table of contents says %s (%d)", typ, n, elem.Type, elem.Len)
+		}
+		img, err := png.Decode(bytes.NewReader(buf[off+8 : off+int(elem.Len)]))
+		if err != nil {
+			t.Fatalf("%s: %v", elem.Type, err)
+		}
+		images[elem.Type] = img
+		off += int(elem.Len)
+	}
+	if off != len(buf) {
+		t.Fatalf("%d bytes after the last element", len(buf)-off)
+	}
+	return images
+}
+
+func TestWriteIcns(t *testing.T) {
+	tests := []struct {
+		name string
+		src  image.Image
+	}{
+		{"large", testImage(1024)},
+		{"small", testImage(64)},
+		{"not square", image.NewNRGBA(image.Rect(0, 0, 300, 200))},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeIcns(&buf, tt.src); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		images := readIcns(t, buf.Bytes())
+		if len(images) != len(icnsTypes) {
+			t.Errorf("%s: %d elements, want %d", tt.name, len(images), len(icnsTypes))
+		}
+		for _, elem := range icnsTypes {
+			img, ok := images[elem.Type]
+			if !ok {
+				t.Errorf("%s: no %s element", tt.name, elem.Type)
+				continue
+			}
+			if b := img.Bounds(); b.Dx() != elem.Size || b.Dy() != elem.Size {
+				t.Errorf("%s: %s is %dx%d, want %d", tt.name, elem.Type, b.Dx(), b.Dy(), elem.Size)
+			}
+		}
+		// the middle stays red, corners stay transparent
+		if tt.name != "not square" {
+			img := images["ic07"]
+			if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+				t.Errorf("%s: corner is not transparent", tt.name)
+			}
+			if r, g, _, a := img.At(64, 64).RGBA(); r != 0xffff || g != 0 || a != 0xffff {
+				t.Errorf("%s: middle is not red", tt.name)
+			}
+		}
+	}
+}
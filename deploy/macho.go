@@ -0,0 +1,185 @@
+// macho.go — universal (fat) Mach-O binaries, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+const (
+	fatAlign = 14 // 16K pages, enough for both x86_64 and arm64
+	// fatMaxOffset is the limit of 32-bit fat_arch offsets
+	fatMaxOffset = 1<<32 - 1
+)
+
+// universalArches are GOARCHes merged into a universal binary.
+var universalArches = []string{"amd64", "arm64"}
+
+var machoArches = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+// fatArch is fat_arch of <mach-o/fat.h>, all fields are big-endian.
+type fatArch struct {
+	Cpu    macho.Cpu
+	SubCpu uint32
+	Offset uint32
+	Size   uint32
+	Align  uint32
+}
+
+// writeFatMachO merges thin Mach-O files into a universal one, like `lipo -create`
+// does. Slices are ordered by GOARCH so the output doesn't depend on the input order.
+func writeFatMachO(name string, thin []string) (err error) {
+	type slice struct {
+		arch string
+		hdr  macho.FileHeader
+		data []byte
+	}
+	var slices []slice
+	seen := make(map[macho.Cpu]string)
+	for _, path := range thin {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := macho.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("fat: %s: %v", path, err)
+		}
+		arch := machoArch(file.Cpu)
+		if prev, ok := seen[file.Cpu]; ok {
+			return fmt.Errorf("fat: %s and %s are both %s", prev, path, arch)
+		}
+		seen[file.Cpu] = path
+		slices = append(slices, slice{arch, file.FileHeader, data})
+	}
+	if len(slices) < 1 {
+		return fmt.Errorf("fat: nothing to merge")
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		return slices[i].arch < slices[j].arch
+	})
+
+	// fat_header is followed by fat_arch entries, slices start at aligned offsets
+	align := uint64(1) << fatAlign
+	offset := uint64(8 + 20*len(slices))
+	archs := make([]fatArch, len(slices))
+	for i, s := range slices {
+		offset = (offset + align - 1) &^ (align - 1)
+		if offset+uint64(len(s.data)) > fatMaxOffset {
+			return fmt.Errorf("fat: %s slice doesn't fit 32-bit offsets", s.arch)
+		}
+		archs[i] = fatArch{
+			Cpu:    s.hdr.Cpu,
+			SubCpu: s.hdr.SubCpu,
+			Offset: uint32(offset),
+			Size:   uint32(len(s.data)),
+			Align:  fatAlign,
+		}
+		offset += uint64(len(s.data))
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, [2]uint32{macho.MagicFat, uint32(len(slices))})
+	binary.Write(&buf, binary.BigEndian, archs)
+	for i, s := range slices {
+		buf.Write(make([]byte, int(archs[i].Offset)-buf.Len()))
+		buf.Write(s.data)
+	}
+	return ioutil.WriteFile(name, buf.Bytes(), 0755)
+}
+
+// machoSlices returns GOARCHes of the slices of a Mach-O file,
+// a thin file has only one.
+func machoSlices(name string) (arches []string, err error) {
+	fat, err := macho.OpenFat(name)
+	if err == macho.ErrNotFat {
+		file, err := macho.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return []string{machoArch(file.Cpu)}, nil
+	} else if err != nil {
+		return
+	}
+	defer fat.Close()
+	for _, arch := range fat.Arches {
+		arches = append(arches, machoArch(arch.Cpu))
+	}
+	return
+}
+
+func machoArch(cpu macho.Cpu) string {
+	if arch, ok := machoArches[cpu]; ok {
+		return arch
+	}
+	return cpu.String()
+}
+
+// missingSlices returns which of want arches the Mach-O file lacks.
+func missingSlices(name string, want []string) (missing []string, err error) {
+	arches, err := machoSlices(name)
+	if err != nil {
+		return
+	}
+	has := make(map[string]bool)
+	for _, arch := range arches {
+		has[arch] = true
+	}
+	for _, arch := range want {
+		if !has[arch] {
+			missing = append(missing, arch)
+		}
+	}
+	return
+}
+
+// openMachO opens a thin or fat Mach-O file, for a fat one the first slice is
+// returned, load commands relevant for relinking are the same in all of them.
+func openMachO(name string) (*macho.File, io.Closer, error) {
+	fat, err := macho.OpenFat(name)
+	if err == nil {
+		return fat.Arches[0].File, fat, nil
+	} else if err != macho.ErrNotFat {
+		return nil, nil, err
+	}
+	file, err := macho.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file, nil
+}
@@ -0,0 +1,143 @@
+// macho_test.go — tests of the universal binary writer, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeThinMachO writes a 64-bit Mach-O executable with no load commands,
+// the payload follows the header.
+func writeThinMachO(t *testing.T, name string, cpu macho.Cpu, payload string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   cpu,
+		Type:  macho.TypeExec,
+	})
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // reserved
+	buf.WriteString(payload)
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteFatMachO(t *testing.T) {
+	dir := t.TempDir()
+	thin := map[string][]byte{
+		"amd64": writeThinMachO(t, filepath.Join(dir, "amd64"), macho.CpuAmd64, "amd64 code"),
+		"arm64": writeThinMachO(t, filepath.Join(dir, "arm64"), macho.CpuArm64, strings.Repeat("arm64 code", 2000)),
+	}
+	writeThinMachO(t, filepath.Join(dir, "arm64-2"), macho.CpuArm64, "more arm64 code")
+	if err := ioutil.WriteFile(filepath.Join(dir, "text"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	names := func(list ...string) (paths []string) {
+		for _, name := range list {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return
+	}
+
+	fat := filepath.Join(dir, "fat")
+	if err := writeFatMachO(fat, names("arm64", "amd64")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.OpenFat(fat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadFile(fat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var arches []string
+	for _, arch := range f.Arches {
+		name := machoArch(arch.Cpu)
+		arches = append(arches, name)
+		if arch.Align != fatAlign || arch.Offset%(1<<fatAlign) != 0 {
+			t.Errorf("%s: slice at %d is not aligned to 2^%d", name, arch.Offset, arch.Align)
+		}
+		if arch.Type != macho.TypeExec {
+			t.Errorf("%s: got type %v", name, arch.Type)
+		}
+		if !bytes.Equal(data[arch.Offset:arch.Offset+arch.Size], thin[name]) {
+			t.Errorf("%s: slice differs from the thin file", name)
+		}
+	}
+	if want := []string{"amd64", "arm64"}; !reflect.DeepEqual(arches, want) {
+		t.Errorf("got slices %v, want %v", arches, want)
+	}
+
+	// the order of thin files doesn't matter
+	fat2 := filepath.Join(dir, "fat2")
+	if err = writeFatMachO(fat2, names("amd64", "arm64")); err != nil {
+		t.Fatal(err)
+	}
+	if data2, err := ioutil.ReadFile(fat2); err != nil || !bytes.Equal(data, data2) {
+		t.Errorf("output depends on the order of thin files (%v)", err)
+	}
+
+	if arches, err := machoSlices(fat); err != nil || !reflect.DeepEqual(arches, []string{"amd64", "arm64"}) {
+		t.Errorf("fat: got slices %v (%v)", arches, err)
+	}
+	if arches, err := machoSlices(filepath.Join(dir, "arm64")); err != nil || !reflect.DeepEqual(arches, []string{"arm64"}) {
+		t.Errorf("thin: got slices %v (%v)", arches, err)
+	}
+	if missing, err := missingSlices(fat, []string{"386", "amd64", "arm64"}); err != nil || !reflect.DeepEqual(missing, []string{"386"}) {
+		t.Errorf("got missing slices %v (%v)", missing, err)
+	}
+	file, closer, err := openMachO(fat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Cpu != macho.CpuAmd64 {
+		t.Errorf("openMachO: got %v slice", file.Cpu)
+	}
+	closer.Close()
+
+	for _, tt := range []struct {
+		name string
+		thin []string
+		err  string
+	}{
+		{"empty", nil, "nothing to merge"},
+		{"duplicate", names("arm64", "amd64", "arm64-2"), "are both arm64"},
+		{"not mach-o", names("amd64", "text"), "text"},
+	} {
+		err := writeFatMachO(filepath.Join(dir, tt.name), tt.thin)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// plist.go — property list encoder, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const plistHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+`
+
+// encodePlist writes v as an XML property list. Supported values are strings,
+// booleans, numbers, time.Time, []byte, slices and maps with string keys
+// (maps decoded from YAML are fine too). Dict keys are sorted.
+func encodePlist(w io.Writer, v interface{}) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(plistHeader)
+	if err := encodePlistValue(buf, reflect.ValueOf(v), 0); err != nil {
+		return err
+	}
+	buf.WriteString("</plist>\n")
+	return buf.Flush()
+}
+
+// writePlist encodes v into the file name.
+func writePlist(name string, v interface{}) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := encodePlist(file, v); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return file.Close()
+}
+
+func encodePlistValue(w *bufio.Writer, v reflect.Value, depth int) error {
+	indent := strings.Repeat("\t", depth)
+	if !v.IsValid() {
+		return fmt.Errorf("plist: nil value")
+	}
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return fmt.Errorf("plist: nil value")
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		fmt.Fprintf(w, "%s<date>%s</date>\n", indent, t.UTC().Format(time.RFC3339))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		fmt.Fprintf(w, "%s<string>%s</string>\n", indent, plistEscape(v.String()))
+	case reflect.Bool:
+		if v.Bool() {
+			fmt.Fprintf(w, "%s<true/>\n", indent)
+		} else {
+			fmt.Fprintf(w, "%s<false/>\n", indent)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(w, "%s<integer>%d</integer>\n", indent, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprintf(w, "%s<integer>%d</integer>\n", indent, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(w, "%s<real>%v</real>\n", indent, v.Float())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			fmt.Fprintf(w, "%s<data>%s</data>\n", indent, base64.StdEncoding.EncodeToString(data))
+			return nil
+		}
+		fmt.Fprintf(w, "%s<array>\n", indent)
+		for i := 0; i < v.Len(); i++ {
+			if err := encodePlistValue(w, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%s</array>\n", indent)
+	case reflect.Map:
+		keys := make(map[string]reflect.Value, v.Len())
+		names := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			keys[name] = key
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "%s<dict>\n", indent)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t<key>%s</key>\n", indent, plistEscape(name))
+			if err := encodePlistValue(w, v.MapIndex(keys[name]), depth+1); err != nil {
+				return fmt.Errorf("%v (key %s)", err, name)
+			}
+		}
+		fmt.Fprintf(w, "%s</dict>\n", indent)
+	default:
+		return fmt.Errorf("plist: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func plistEscape(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
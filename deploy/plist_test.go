@@ -0,0 +1,123 @@
+// plist_test.go — tests of the property list encoder and bundle identifiers, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodePlist(t *testing.T) {
+	// maps decoded from YAML have interface{} keys
+	v := map[string]interface{}{
+		"b": "<a & b>",
+		"a": []interface{}{1, true, 1.5},
+		"c": map[interface{}]interface{}{
+			"z": false,
+			"y": []byte("hi"),
+			"x": time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+	want := plistHeader + `<dict>
+	<key>a</key>
+	<array>
+		<integer>1</integer>
+		<true/>
+		<real>1.5</real>
+	</array>
+	<key>b</key>
+	<string>&lt;a &amp; b&gt;</string>
+	<key>c</key>
+	<dict>
+		<key>x</key>
+		<date>2015-01-02T03:04:05Z</date>
+		<key>y</key>
+		<data>aGk=</data>
+		<key>z</key>
+		<false/>
+	</dict>
+</dict>
+</plist>
+`
+	var buf bytes.Buffer
+	if err := encodePlist(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEncodePlistErrors(t *testing.T) {
+	var nilString *string
+	tests := []struct {
+		name string
+		v    interface{}
+		err  string
+	}{
+		{"nil", nil, "nil value"},
+		{"nil pointer", nilString, "nil value"},
+		{"nil in dict", map[string]interface{}{"key": nil}, "key key"},
+		{"nil in array", []interface{}{"a", nil}, "nil value"},
+		{"unsupported", map[string]interface{}{"ch": make(chan int)}, "unsupported type"},
+	}
+	for _, tt := range tests {
+		err := encodePlist(&bytes.Buffer{}, tt.v)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestBundleIdentifier(t *testing.T) {
+	tests := []struct {
+		importPath string
+		id         string
+		valid      bool
+	}{
+		{"github.com/user/app", "com.github.user.app", true},
+		{"gopkg.in/qml-kit.v0", "in.gopkg.qml-kit.v0", true},
+		{"example.com/my_app/cmd/viewer", "com.example.my-app.cmd.viewer", true},
+		{"example.com/app v2", "com.example.app-v2", true},
+		{"app", "local.app", true},
+		{"my_host.lan/app", "lan.my_host.app", false},
+		{"example..com/app", "com..example.app", false},
+	}
+	for _, tt := range tests {
+		id := bundleIdentifier(tt.importPath)
+		if id != tt.id {
+			t.Errorf("%s: got %s, want %s", tt.importPath, id, tt.id)
+		}
+		if valid := validBundleIdentifier(id); valid != tt.valid {
+			t.Errorf("%s: got valid %v, want %v", tt.importPath, valid, tt.valid)
+		}
+	}
+	for _, id := range []string{"app", "com.example.", "com.example.my app", "com.example.app_2", "com.exämple.app"} {
+		if validBundleIdentifier(id) {
+			t.Errorf("%s: accepted", id)
+		}
+	}
+}
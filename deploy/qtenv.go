@@ -0,0 +1,282 @@
+// qtenv.go — cgo environment and Qt linkage checks, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// linkedQt describes the QtCore a binary is linked against, fields
+// are empty if they can't be told from the binary.
+type linkedQt struct {
+	Lib     string // as referenced by the binary
+	Major   string
+	Version string // exact (darwin) or the minimal required one (linux)
+}
+
+// cgoEnv returns env vars that make cgo (and pkg-config called by it) find the
+// Qt being deployed rather than some other Qt installed in the system. Qt flags
+// are appended to the ones of go env, cmd/go applies its "-O2 -g" default only
+// if the vars are empty.
+func cgoEnv(r *runner, qt qtInfo) map[string]string {
+	env := make(map[string]string)
+	if len(qt.LibPath) < 1 {
+		return env
+	}
+	pkgConfig := filepath.Join(qt.LibPath, "pkgconfig")
+	if prev := os.Getenv("PKG_CONFIG_PATH"); len(prev) > 0 {
+		pkgConfig += string(os.PathListSeparator) + prev
+	}
+	env["PKG_CONFIG_PATH"] = pkgConfig
+	cxxflags, ldflags := goCgoFlags(r)
+	if len(qt.HeaderPath) > 0 {
+		cxxflags += " " + cgoQuote("-I"+qt.HeaderPath)
+	}
+	ldflags += " " + cgoQuote("-L"+qt.LibPath)
+	if runtime.GOOS == "darwin" {
+		cxxflags += " " + cgoQuote("-F"+qt.LibPath)
+		ldflags += " " + cgoQuote("-F"+qt.LibPath)
+	}
+	env["CGO_CXXFLAGS"] = strings.TrimSpace(cxxflags)
+	env["CGO_LDFLAGS"] = strings.TrimSpace(ldflags)
+	return env
+}
+
+// defaultCgoFlags are the ones cmd/go uses when CGO_*FLAGS are not set.
+const defaultCgoFlags = "-O2 -g"
+
+// goCgoFlags returns CGO_CXXFLAGS and CGO_LDFLAGS go build would use, these
+// may be set with go env -w as well. The result is kept for the runner.
+func goCgoFlags(r *runner) (cxxflags, ldflags string) {
+	r.cgoOnce.Do(func() {
+		flags := [2]string{os.Getenv("CGO_CXXFLAGS"), os.Getenv("CGO_LDFLAGS")}
+		cmd := exec.Command("go", "env", "CGO_CXXFLAGS", "CGO_LDFLAGS")
+		if buf, err := r.run(cmd); err == nil {
+			if lines := strings.Split(string(buf), "\n"); len(lines) > 1 {
+				flags[0], flags[1] = lines[0], lines[1]
+			}
+		}
+		for i := range flags {
+			if flags[i] = strings.TrimSpace(flags[i]); len(flags[i]) < 1 {
+				flags[i] = defaultCgoFlags
+			}
+		}
+		r.cgoFlags = flags
+	})
+	return r.cgoFlags[0], r.cgoFlags[1]
+}
+
+func cgoQuote(flag string) string {
+	if strings.ContainsAny(flag, " \t'\"") {
+		return strconv.Quote(flag)
+	}
+	return flag
+}
+
+// checkPkgConfig makes sure pkg-config run with env resolves QtCore to the Qt
+// being deployed. The check is skipped if there is no pkg-config, a Qt without
+// the .pc file (i.e. macOS frameworks or Windows installers) is only warned about.
+func checkPkgConfig(r *runner, env []string, qt qtInfo) error {
+	if _, err := exec.LookPath("pkg-config"); err != nil {
+		return nil
+	}
+	module := "Qt" + qt.Major + "Core"
+	cmd := exec.Command("pkg-config", "--exists", module)
+	cmd.Env = env
+	if _, err := r.run(cmd); err != nil {
+		r.emit(Event{Level: Warning, Msg: fmt.Sprintf("qt check: pkg-config doesn't know %s, "+
+			"skipping the check of Qt cgo links against", module)})
+		return nil
+	}
+	cmd = exec.Command("pkg-config", "--variable=libdir", module)
+	cmd.Env = env
+	buf, err := r.run(cmd)
+	if err != nil {
+		return fmt.Errorf("qt check: %v", err)
+	}
+	libdir := strings.TrimSpace(string(buf))
+	if !samePath(libdir, qt.LibPath) {
+		return fmt.Errorf("qt check: cgo would link against another Qt:\n"+
+			"    pkg-config %s: %s\n"+
+			"    qmake:         %s (%s)",
+			module, libdir, qt.LibPath, qt.Version)
+	}
+	return nil
+}
+
+// checkLinkedQt verifies that the binary links QtCore of the Qt being bundled,
+// binaries not linked with Qt at all pass the check.
+func checkLinkedQt(name string, qt qtInfo) error {
+	linked, err := readLinkedQt(name)
+	if err != nil {
+		return fmt.Errorf("qt check: %v", err)
+	}
+	if len(linked.Lib) < 1 {
+		return nil
+	}
+	mismatch := func(what string) error {
+		return fmt.Errorf("qt check: %s links %s Qt than the one being bundled:\n"+
+			"    binary:  %s (Qt %s)\n"+
+			"    bundled: %s (Qt %s)",
+			filepath.Base(name), what, linked.Lib, linked.Version, qt.LibPath, qt.Version)
+	}
+	if len(linked.Major) > 0 && linked.Major != qt.Major {
+		return mismatch("another major version of")
+	}
+	if len(linked.Version) > 0 && compareVersions(linked.Version, qt.Version) > 0 {
+		return mismatch("a newer")
+	}
+	if runtime.GOOS == "darwin" && filepath.IsAbs(linked.Lib) {
+		if idx := strings.Index(linked.Lib, "/QtCore.framework"); idx > 0 {
+			if !samePath(linked.Lib[:idx], qt.LibPath) {
+				return mismatch("another")
+			}
+		}
+		if len(linked.Version) > 0 && compareVersions(linked.Version, qt.Version) != 0 {
+			return mismatch("another version of")
+		}
+	}
+	return nil
+}
+
+// readLinkedQt inspects imports of the binary for QtCore.
+func readLinkedQt(name string) (linkedQt, error) {
+	var linked linkedQt
+	switch runtime.GOOS {
+	case "darwin":
+		file, closer, err := openMachO(name)
+		if err != nil {
+			return linked, err
+		}
+		defer closer.Close()
+		for _, load := range file.Loads {
+			lib, ok := load.(*macho.Dylib)
+			if !ok || !strings.Contains(lib.Name, "QtCore") {
+				continue
+			}
+			v := lib.CurrentVersion
+			linked.Lib = lib.Name
+			linked.Version = fmt.Sprintf("%d.%d.%d", v>>16, v>>8&0xff, v&0xff)
+			linked.Major = fmt.Sprint(v >> 16)
+		}
+	case "windows":
+		file, err := pe.Open(name)
+		if err != nil {
+			return linked, err
+		}
+		defer file.Close()
+		libs, err := file.ImportedLibraries()
+		if err != nil {
+			return linked, err
+		}
+		for _, lib := range libs {
+			// Qt5Core.dll
+			lower := strings.ToLower(lib)
+			if strings.HasPrefix(lower, "qt") && strings.HasSuffix(lower, "core.dll") {
+				linked.Lib = lib
+				linked.Major = strings.TrimSuffix(lower[2:], "core.dll")
+			}
+		}
+	default:
+		file, err := elf.Open(name)
+		if err != nil {
+			return linked, err
+		}
+		defer file.Close()
+		libs, err := file.ImportedLibraries()
+		if err != nil {
+			return linked, err
+		}
+		for _, lib := range libs {
+			// libQt5Core.so.5
+			if strings.HasPrefix(lib, "libQt") && strings.Contains(lib, "Core.so") {
+				linked.Lib = lib
+				linked.Major = strings.SplitN(strings.TrimPrefix(lib, "libQt"), "Core", 2)[0]
+			}
+		}
+		if len(linked.Lib) < 1 {
+			return linked, nil
+		}
+		// versioned symbols tell the minimal Qt release, i.e. Qt_5.4
+		syms, err := file.ImportedSymbols()
+		if err != nil {
+			return linked, nil
+		}
+		for _, sym := range syms {
+			if sym.Library != linked.Lib || !strings.HasPrefix(sym.Version, "Qt_") {
+				continue
+			}
+			v := strings.TrimPrefix(sym.Version, "Qt_")
+			if !isDigits(strings.Replace(v, ".", "", -1)) {
+				continue // Qt_5_PRIVATE_API
+			}
+			if len(linked.Version) < 1 || compareVersions(v, linked.Version) > 0 {
+				linked.Version = v
+			}
+		}
+	}
+	return linked, nil
+}
+
+// compareVersions compares dot-separated numeric versions, missing parts are zeroes.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// samePath compares paths resolving symlinks, homebrew links Qt to /usr/local/opt for example.
+func samePath(a, b string) bool {
+	resolve := func(path string) string {
+		path = filepath.Clean(path)
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return real
+		}
+		return path
+	}
+	return resolve(a) == resolve(b)
+}
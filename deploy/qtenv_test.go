@@ -0,0 +1,91 @@
+// qtenv_test.go — tests of the cgo environment and Qt linkage checks, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCgoEnv(t *testing.T) {
+	qt := qtInfo{HeaderPath: "/qt/include", LibPath: "/qt/lib"}
+	tests := []struct {
+		name     string
+		cxxflags string // $CGO_CXXFLAGS
+		want     string // prefix of CGO_CXXFLAGS passed to go build
+	}{
+		{"default", "", "-O2 -g -I/qt/include"},
+		{"env", "-O1", "-O1 -I/qt/include"},
+	}
+	for _, tt := range tests {
+		t.Setenv("CGO_CXXFLAGS", tt.cxxflags)
+		t.Setenv("CGO_LDFLAGS", "")
+		env := cgoEnv(newRunner(&Config{}), qt)
+		if got := env["CGO_CXXFLAGS"]; !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got CGO_CXXFLAGS %q, want %q first", tt.name, got, tt.want)
+		}
+		if got, want := env["CGO_LDFLAGS"], "-O2 -g -L/qt/lib"; !strings.HasPrefix(got, want) {
+			t.Errorf("%s: got CGO_LDFLAGS %q, want %q first", tt.name, got, want)
+		}
+	}
+}
+
+func TestCheckPkgConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pkg-config is a shell script")
+	}
+	qt := qtInfo{Major: "5", LibPath: t.TempDir()}
+	tests := []struct {
+		name    string
+		script  string // of the fake pkg-config
+		err     bool
+		warning bool
+	}{
+		{"same Qt", "echo " + qt.LibPath, false, false},
+		{"no module", "exit 1", false, true},
+		{"another Qt", "[ \"$1\" = --exists ] || echo /opt/other/lib", true, false},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		script := "#!/bin/sh\n" + tt.script + "\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "pkg-config"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", dir)
+		var warning bool
+		r := newRunner(&Config{Events: func(e Event) {
+			warning = warning || e.Level == Warning
+		}})
+		err := checkPkgConfig(r, nil, qt)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+		if warning != tt.warning {
+			t.Errorf("%s: got warning %v, want %v", tt.name, warning, tt.warning)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// reproducible.go — deterministic deploy outputs and their check, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releaseTime returns the time stamped into the binary and generated files and set
+// as mtime of the package files: $SOURCE_DATE_EPOCH, the commit time if the
+// project in dir is in git or the current time as the last resort.
+func releaseTime(r *runner, dir string) (t time.Time, err error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); len(epoch) > 0 {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return t, fmt.Errorf("deploy: SOURCE_DATE_EPOCH: %v", err)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	cmd := exec.Command("git", "log", "-1", "--format=%ct")
+	cmd.Dir = dir
+	if buf, err := r.run(cmd); err == nil {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC(), nil
+		}
+	}
+	return time.Now().UTC().Truncate(time.Second), nil
+}
+
+// normalizeTree sets mtime of every file and dir under root to t and drops
+// modes to 0755 for dirs and executables and 0644 for other files, so they
+// don't depend on when and with what umask the deployment was run.
+// Symlinks are left as they are.
+func normalizeTree(root string, t time.Time) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		if mode&os.ModeSymlink != 0 {
+			return nil
+		}
+		perm := os.FileMode(0644)
+		if mode.IsDir() || mode&0111 != 0 {
+			perm = 0755
+		}
+		if mode.Perm() != perm {
+			if err = os.Chmod(path, perm); err != nil {
+				return err
+			}
+		}
+		return os.Chtimes(path, t, t)
+	})
+}
+
+// treeEntry is what is compared of a file by diffTrees.
+type treeEntry struct {
+	Mode  os.FileMode
+	MTime time.Time
+	Sum   [sha256.Size]byte // contents of a file, target of a symlink
+}
+
+func readTree(root string) (entries map[string]treeEntry, err error) {
+	entries = make(map[string]treeEntry)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		e := treeEntry{Mode: info.Mode()}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			e.Sum = sha256.Sum256([]byte(link))
+		case info.Mode().IsRegular():
+			e.MTime = info.ModTime()
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			h := sha256.New()
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			copy(e.Sum[:], h.Sum(nil))
+		default:
+			e.MTime = info.ModTime()
+		}
+		entries[filepath.ToSlash(name)] = e
+		return nil
+	})
+	return
+}
+
+// diffTrees returns sorted names of files differing between dirs a and b,
+// including the ones that exist in one of them only.
+func diffTrees(a, b string) (diff []string, err error) {
+	ta, err := readTree(a)
+	if err != nil {
+		return
+	}
+	tb, err := readTree(b)
+	if err != nil {
+		return
+	}
+	for name, ea := range ta {
+		if eb, ok := tb[name]; !ok || ea.Mode != eb.Mode || !ea.MTime.Equal(eb.MTime) ||
+			!bytes.Equal(ea.Sum[:], eb.Sum[:]) {
+			diff = append(diff, name)
+		}
+	}
+	for name := range tb {
+		if _, ok := ta[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return
+}
+
+// checkDeploy deploys cfg once more into dir and compares the result with
+// cfg.Path. Both are compared before the after-finalize hooks, which are run for
+// the first deployment only, once the check passes. Hooks of other stages shape
+// the package, so they run in both. Disk images carry random ids, so they are
+// not created.
+func checkDeploy(cfg *config, target, dir string) (err error) {
+	defer os.RemoveAll(dir)
+	second := *cfg
+	second.Path = filepath.Join(dir, target)
+	if err = os.MkdirAll(second.Path, 0755); err != nil {
+		return
+	}
+	cfg.debugf("check: deploying again into %s", second.Path)
+	if _, err = deploy(&second, target); err != nil {
+		return fmt.Errorf("check: %v", err)
+	}
+	for _, path := range []string{cfg.Path, second.Path} {
+		if err = normalizeTree(path, cfg.Release.Time); err != nil {
+			return
+		}
+	}
+	diff, err := diffTrees(cfg.Path, second.Path)
+	if err != nil {
+		return fmt.Errorf("check: %v", err)
+	}
+	if len(diff) > 0 {
+		const max = 10
+		names := diff
+		if len(names) > max {
+			names = append(names[:max:max], fmt.Sprintf("and %d more", len(diff)-max))
+		}
+		return fmt.Errorf("deploy: check: %d file(s) differ between deployments: %s",
+			len(diff), strings.Join(names, ", "))
+	}
+	cfg.debugf("check: deployments are identical")
+	return
+}
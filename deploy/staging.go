@@ -0,0 +1,90 @@
+// staging.go — atomic replacement of deploy outputs, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dirs and files kept next to the output dir of a target, i.e. out/.darwin.lock.
+const (
+	lockSuffix    = ".lock"    // held while the target is deployed or cleaned
+	stagingSuffix = ".staging" // the package being deployed
+	checkSuffix   = ".check"   // the second deployment of a check
+	oldSuffix     = ".old"     // the previous package while it is being replaced
+)
+
+// siblingPath returns the path of a hidden file next to path: out/darwin -> out/.darwin<suffix>.
+func siblingPath(path, suffix string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+suffix)
+}
+
+// lockOutput creates the lock file of the output dir, it fails if another
+// deployment holds it. The lock is released by the returned func.
+func lockOutput(path string) (unlock func(), err error) {
+	name := siblingPath(path, lockSuffix)
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		pid, _ := ioutil.ReadFile(name)
+		return nil, fmt.Errorf("deploy: %s is locked by another deploy (pid %s), remove %s if it is not running",
+			path, strings.TrimSpace(string(pid)), name)
+	} else if err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(f, os.Getpid())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return
+	}
+	return func() { os.Remove(name) }, nil
+}
+
+// replaceDir puts staging in place of path, the previous contents of path are
+// removed only after staging is renamed, so path is either old or new one.
+func replaceDir(staging, path string) (err error) {
+	old := siblingPath(path, oldSuffix)
+	if err = os.RemoveAll(old); err != nil {
+		return
+	}
+	if err = os.Rename(path, old); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Rename(staging, path); err != nil {
+		if rerr := os.Rename(old, path); rerr != nil && !os.IsNotExist(rerr) {
+			return fmt.Errorf("%v (restore: %v)", err, rerr)
+		}
+		return
+	}
+	return os.RemoveAll(old)
+}
@@ -0,0 +1,237 @@
+// target.go — deployer interface and target registry, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Deployer is a deployment routine of a target. Stages are run in order: Layout
+// creates the structure of the package, Build builds binaries into it, Libs,
+// Plugins and Modules copy Qt files and Finalize writes qt.conf and the like.
+// Embed BaseDeployer to get default implementations of the stages.
+type Deployer interface {
+	Layout(job *Job) error
+	Build(job *Job) error
+	Libs(job *Job) error
+	Plugins(job *Job) error
+	Modules(job *Job) error
+	Finalize(job *Job) error
+}
+
+// packager may be implemented by a Deployer to turn the finished package into an
+// image or archive, it is run after the after-finalize hooks.
+type packager interface {
+	Package(job *Job) error
+}
+
+// Target is a registered target. GOOS is the platform binaries are built
+// for, Layout holds the default layout rules the profile may override.
+type Target struct {
+	GOOS   string
+	Layout Layout
+	New    func() Deployer
+}
+
+// RegisterTarget makes a target available to Config.Target, call it from init()
+// of your own package. Layout of a built-in target may be reused:
+//
+//     func init() {
+//         linux, _ := deploy.LookupTarget("linux")
+//         deploy.RegisterTarget("embedded", deploy.Target{
+//             GOOS:   "linux",
+//             Layout: linux.Layout,
+//             New:    func() deploy.Deployer { return &embeddedDeployer{} },
+//         })
+//     }
+func RegisterTarget(name string, target Target) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	if _, ok := deployTargets[name]; ok {
+		panic("deploy: target registered twice: " + name)
+	}
+	deployTargets[name] = target
+}
+
+// LookupTarget returns the target registered with name.
+func LookupTarget(name string) (target Target, ok bool) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	target, ok = deployTargets[name]
+	return
+}
+
+// Job is what stages of a Deployer share.
+type Job struct {
+	Target string
+	Layout Layout
+	Plan   Plan
+	Root   string                  // layout root within the output dir
+	Fixup  func(name string) error // called for every file copied, may be nil
+	cfg    *config
+}
+
+func newJob(cfg *config, target string) (job *Job, err error) {
+	plan, err := planLayout(cfg, target)
+	if err != nil {
+		return
+	}
+	job = &Job{
+		Target: target,
+		Layout: cfg.Profile.layout(target),
+		Plan:   plan,
+		Root:   filepath.Join(cfg.Path, plan.Root),
+		cfg:    cfg,
+	}
+	return
+}
+
+// Log reports progress of the job.
+func (job *Job) Log(args ...interface{}) {
+	job.cfg.emit(Event{Level: Info, Target: job.Target, Msg: fmt.Sprint(args...)})
+}
+
+// Warn reports a problem that doesn't stop the job.
+func (job *Job) Warn(args ...interface{}) {
+	job.cfg.emit(Event{Level: Warning, Target: job.Target, Msg: fmt.Sprint(args...)})
+}
+
+// Meta returns metadata of the job, the same hooks get.
+func (job *Job) Meta() Metadata {
+	return newMetadata(job.cfg, job.Target, job.Root)
+}
+
+func (job *Job) vars() layoutVars {
+	return layoutVars{
+		App:     job.cfg.PkgInfo.Name,
+		Qt:      job.cfg.QtInfo,
+		Release: job.cfg.Release,
+	}
+}
+
+// BinPath returns where the binary goes according to the layout.
+func (job *Job) BinPath(name string) (string, error) {
+	vars := job.vars()
+	vars.Name = name
+	path, err := job.Layout.expand(job.Layout.Bin, vars)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(job.Root, path), nil
+}
+
+// runDeployer runs stages of the deployer and hooks between them, the returned
+// finish runs the after-finalize hooks, normalizes the package and packages it.
+func runDeployer(d Deployer, job *Job) (finish func() error, err error) {
+	stages := []struct {
+		name string
+		run  func(*Job) error
+		hook string
+	}{
+		{"layout", d.Layout, ""},
+		{"build", d.Build, stageAfterBuild},
+		{"libs", d.Libs, stageAfterLibs},
+		{"plugins", d.Plugins, ""},
+		{"modules", d.Modules, ""},
+		{"finalize", d.Finalize, ""},
+	}
+	for _, stage := range stages {
+		job.Log(stage.name)
+		if err = stage.run(job); err != nil {
+			return
+		}
+		if len(stage.hook) > 0 {
+			if err = runHooks(job.cfg, job.Target, stage.hook); err != nil {
+				return
+			}
+		}
+	}
+	finish = func() (err error) {
+		if err = runHooks(job.cfg, job.Target, stageAfterFinalize); err != nil {
+			return
+		}
+		if err = normalizeTree(job.cfg.Path, job.cfg.Release.Time); err != nil {
+			return
+		}
+		if p, ok := d.(packager); ok {
+			job.Log("package")
+			err = p.Package(job)
+		}
+		return
+	}
+	return
+}
+
+// BaseDeployer implements stages the way most targets need them.
+type BaseDeployer struct{}
+
+// Layout creates the root and plugin category dirs, the latter even if empty.
+func (BaseDeployer) Layout(job *Job) (err error) {
+	if err = os.MkdirAll(job.Root, 0755); err != nil {
+		return
+	}
+	for _, dir := range job.Plan.Dirs {
+		if err = os.MkdirAll(filepath.Join(job.Root, dir), 0755); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Build builds every binary to the location set by the layout.
+func (BaseDeployer) Build(job *Job) (err error) {
+	for _, bin := range job.cfg.Binaries {
+		job.Log("building executable ", bin.Pkg.Name)
+		name, err := job.BinPath(bin.Pkg.Name)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err = goBuild(job.cfg, bin.Pkg, name); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+func (BaseDeployer) Libs(job *Job) error {
+	return job.CopyFiles("libs", "extra")
+}
+
+func (BaseDeployer) Plugins(job *Job) error {
+	return job.CopyFiles("plugins")
+}
+
+func (BaseDeployer) Modules(job *Job) error {
+	return job.CopyFiles("qml", "modules", "translations")
+}
+
+// Finalize writes qt.conf.
+func (BaseDeployer) Finalize(job *Job) error {
+	return writeQtConf(job.cfg, job.Target, job.Layout, job.Root)
+}
@@ -0,0 +1,282 @@
+// target_test.go — tests of the deploy pipeline with a registered target, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDeployer writes a stub binary instead of building one and fails
+// the stage named by fail.
+type fakeDeployer struct {
+	BaseDeployer
+	fail string
+}
+
+func (d *fakeDeployer) Build(job *Job) error {
+	for _, bin := range job.cfg.Binaries {
+		name, err := job.BinPath(bin.Pkg.Name)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(name, []byte(job.Target), 0755); err != nil {
+			return err
+		}
+	}
+	return d.failAt("build")
+}
+
+func (d *fakeDeployer) Libs(job *Job) error {
+	if err := d.BaseDeployer.Libs(job); err != nil {
+		return err
+	}
+	return d.failAt("libs")
+}
+
+func (d *fakeDeployer) failAt(stage string) error {
+	if d.fail == stage {
+		return errors.New("fake failure")
+	}
+	return nil
+}
+
+// registerFakeTarget registers a target of the current platform with the linux
+// layout, it is unregistered when the test ends.
+func registerFakeTarget(t *testing.T, name, fail string) {
+	linux, _ := LookupTarget("linux")
+	RegisterTarget(name, Target{
+		GOOS:   runtime.GOOS,
+		Layout: linux.Layout,
+		New:    func() Deployer { return &fakeDeployer{fail: fail} },
+	})
+	t.Cleanup(func() {
+		targetsMu.Lock()
+		delete(deployTargets, name)
+		targetsMu.Unlock()
+	})
+}
+
+// fakeProject creates a module with a main package, its deploy profile and QML,
+// fake qmake and rice are put into $PATH.
+func fakeProject(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":               "module example.com/fake\n",
+		"main.go":              "package main\n\nfunc main() {}\n",
+		"project/qml/main.qml": "import QtQuick 2.0\n",
+		"deploy_profile.yaml": "hooks:\n" +
+			"    after-finalize:\n" +
+			"        - run: echo \"$QMLKIT_TARGET\" >> \"$QMLKIT_ROOT/hooks.txt\"\n",
+	})
+	bin := t.TempDir()
+	t.Setenv("QMLKIT_QMAKE", fakeQmake(t, bin, "qmake", "-query", qt5Query))
+	if err := ioutil.WriteFile(filepath.Join(bin, "rice"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SOURCE_DATE_EPOCH", "1400000000")
+	return root
+}
+
+func TestPlanLayoutFakeTarget(t *testing.T) {
+	registerFakeTarget(t, "fake-plan", "")
+	cfg := testConfig(t, "5")
+	plan, err := planLayout(cfg, "fake-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := planLayout(cfg, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("got plan %+v, want the linux one %+v", plan, want)
+	}
+}
+
+func TestDeployFakeTarget(t *testing.T) {
+	root := fakeProject(t)
+	registerFakeTarget(t, "fake-ok", "")
+	registerFakeTarget(t, "fake-fail", "libs")
+	out := filepath.Join(root, "out")
+
+	var mu sync.Mutex
+	events := make(map[string][]string)
+	deploy := func(target string) error {
+		return Deploy(Config{
+			Package: root,
+			Target:  target,
+			Version: "1.0.0",
+			Events: func(e Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				if e.Level == Info && len(e.Stage) < 1 {
+					events[target] = append(events[target], e.Target+" "+e.Msg)
+				}
+			},
+		})
+	}
+
+	// deployments of different targets may run at once, each with its own events
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, target := range []string{"fake-ok", "fake-fail"} {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			errs[i] = deploy(target)
+		}(i, target)
+	}
+	wg.Wait()
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if errs[1] == nil || !strings.Contains(errs[1].Error(), "fake failure") {
+		t.Errorf("fake-fail: got error %v", errs[1])
+	}
+
+	want := []string{"layout", "build", "libs", "plugins", "modules", "finalize"}
+	for i := range want {
+		want[i] = "fake-ok " + want[i]
+	}
+	if got := events["fake-ok"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("fake-ok: got events %q, want %q", got, want)
+	}
+	for _, e := range events["fake-fail"] {
+		if !strings.HasPrefix(e, "fake-fail ") {
+			t.Errorf("fake-fail: got event %q of another deployment", e)
+		}
+	}
+
+	pkg := filepath.Join(out, "fake-ok")
+	for name, data := range map[string]string{
+		"fake":         "fake-ok",
+		"qml/main.qml": "import QtQuick 2.0\n",
+		"hooks.txt":    "fake-ok\n",
+	} {
+		buf, err := ioutil.ReadFile(filepath.Join(pkg, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("fake-ok: %v", err)
+		} else if string(buf) != data {
+			t.Errorf("fake-ok: %s: got %q, want %q", name, buf, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(pkg, "qt.conf")); err != nil {
+		t.Errorf("fake-ok: %v", err)
+	}
+	// nothing but the package and its lock is left
+	names, err := filepath.Glob(filepath.Join(out, "*fake-fail*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, lockSuffix) {
+			t.Errorf("fake-fail: %s left", name)
+		}
+	}
+}
+
+func TestDeployCheckHooks(t *testing.T) {
+	root := fakeProject(t)
+	registerFakeTarget(t, "fake-check", "")
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	t.Setenv("HOOK_LOG", log)
+	writeFiles(t, root, map[string]string{
+		"deploy_profile.yaml": "hooks:\n" +
+			"    after-build:\n" +
+			"        - run: echo \"$QMLKIT_STAGE\" >> \"$HOOK_LOG\"\n" +
+			"    after-finalize:\n" +
+			"        - run: echo \"$QMLKIT_STAGE\" >> \"$HOOK_LOG\"; echo signed > \"$QMLKIT_ROOT/signature\"\n",
+	})
+	err := Deploy(Config{Package: root, Target: "fake-check", Version: "1.0.0", Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// after-finalize hooks run once the packages compared equal
+	buf, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "after-build\nafter-build\nafter-finalize\n"; string(buf) != want {
+		t.Errorf("got hooks run %q, want %q", buf, want)
+	}
+	if _, err = os.Stat(filepath.Join(root, "out", "fake-check", "signature")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeployCheckTrimpath(t *testing.T) {
+	root := fakeProject(t)
+	registerFakeTarget(t, "fake-trimpath", "")
+	no := false
+	err := Deploy(Config{Package: root, Target: "fake-trimpath", Version: "1.0.0", Check: true,
+		Build: BuildOptions{Trimpath: &no}})
+	if err == nil || !strings.Contains(err.Error(), "trimpath") {
+		t.Errorf("got error %v, want check to refuse builds without -trimpath", err)
+	}
+}
+
+func TestDeployHookPaths(t *testing.T) {
+	root := fakeProject(t)
+	registerFakeTarget(t, "fake-paths", "")
+	writeFiles(t, root, map[string]string{
+		"deploy_profile.yaml": "hooks:\n" +
+			"    after-finalize:\n" +
+			"        - run: printf '%s\\n%s\\n' \"$QMLKIT_OUT\" \"$QMLKIT_FINAL_OUT\" > \"$QMLKIT_ROOT/paths\"\n",
+	})
+	if err := Deploy(Config{Package: root, Target: "fake-paths", Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	final, err := filepath.Abs(filepath.Join(root, "out", "fake-paths"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(final, "paths"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(paths) != 2 {
+		t.Fatalf("got hook paths %q", buf)
+	}
+	// hooks run in the staging dir, the final one is only filled on success
+	if want := siblingPath(final, stagingSuffix); paths[0] != want {
+		t.Errorf("got QMLKIT_OUT %q, want %q", paths[0], want)
+	}
+	if paths[1] != final {
+		t.Errorf("got QMLKIT_FINAL_OUT %q, want %q", paths[1], final)
+	}
+}
@@ -0,0 +1,562 @@
+// winres.go — Windows resources (icon, version info, manifest), part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf16"
+)
+
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+	rtManifest  = 24
+
+	langEnUS       = 0x0409
+	codepageUTF16  = 0x04b0
+	sysoNameFormat = "qmlkit_rsrc_windows_%s.syso"
+)
+
+// icoSizes are the sizes rendered into Windows icons.
+var icoSizes = []int{16, 24, 32, 48, 64, 128, 256}
+
+// windowsProfile describes the metadata embedded into the .exe.
+type windowsProfile struct {
+	CompanyName    string
+	Description    string
+	Copyright      string
+	ProductName    string
+	Version        string // up to four dot-separated numbers
+	DPIAwareness   string // none, system, permonitor or permonitorv2 (default)
+	ExecutionLevel string // asInvoker (default), highestAvailable or requireAdministrator
+	CommonControls *bool
+}
+
+// winResources is a set of resources to be linked into the .exe.
+type winResources struct {
+	icons    [][]byte // RT_ICON images
+	group    []byte   // RT_GROUP_ICON
+	version  []byte   // RT_VERSION
+	manifest []byte   // RT_MANIFEST
+}
+
+// writeWinSyso generates resources of the executable built from pkg and writes them
+// as a COFF object into its dir, so `go build` links them in. The name of the file
+// is returned.
+func writeWinSyso(pkg pkgInfo, goarch string, cfg *config) (name string, err error) {
+	var res winResources
+	if len(cfg.Profile.Icon) > 0 {
+		img, err := readPNG(cfg.Profile.Icon)
+		if err != nil {
+			return "", fmt.Errorf("icon: %v", err)
+		}
+		if res.icons, res.group, err = renderIcon(img); err != nil {
+			return "", fmt.Errorf("icon: %v", err)
+		}
+	}
+	win := cfg.Profile.Windows
+	if len(win.Version) < 1 {
+		win.Version = cfg.Release.Short()
+	}
+	if res.version, err = versionInfo(pkg, win); err != nil {
+		return
+	}
+	if res.manifest, err = winManifest(pkg, win); err != nil {
+		return
+	}
+	name = fmt.Sprintf(sysoNameFormat, goarch)
+	file, err := os.Create(filepath.Join(pkg.Dir, name))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	if err = writeCOFF(file, goarch, res); err != nil {
+		return
+	}
+	return filepath.Join(pkg.Dir, name), file.Close()
+}
+
+// icoDirEntry is the part of ICONDIRENTRY and GRPICONDIRENTRY both share.
+type icoDirEntry struct {
+	Width, Height, Colors, Reserved uint8
+	Planes, BitCount                uint16
+	BytesInRes                      uint32
+}
+
+func icoEntry(size, length int) icoDirEntry {
+	dim := uint8(size)
+	if size >= 256 {
+		dim = 0
+	}
+	return icoDirEntry{
+		Width:      dim,
+		Height:     dim,
+		Planes:     1,
+		BitCount:   32,
+		BytesInRes: uint32(length),
+	}
+}
+
+// renderIcon renders images for RT_ICON resources and the RT_GROUP_ICON
+// directory referencing them by IDs starting from 1. The 256px image is stored
+// as PNG, the smaller ones as 32-bit DIBs for the sake of older shells.
+func renderIcon(img image.Image) (images [][]byte, group []byte, err error) {
+	var dir bytes.Buffer
+	binary.Write(&dir, binary.LittleEndian, [3]uint16{0, 1, uint16(len(icoSizes))})
+	for i, size := range icoSizes {
+		icon := resizeImage(img, size)
+		var buf bytes.Buffer
+		if size >= 256 {
+			err = png.Encode(&buf, icon)
+		} else {
+			err = writeDIB(&buf, icon)
+		}
+		if err != nil {
+			return
+		}
+		images = append(images, buf.Bytes())
+		binary.Write(&dir, binary.LittleEndian, icoEntry(size, buf.Len()))
+		binary.Write(&dir, binary.LittleEndian, uint16(i+1))
+	}
+	group = dir.Bytes()
+	return
+}
+
+// writeDIB writes a 32-bit BGRA bottom-up bitmap followed by an AND mask,
+// the way icon images are stored. Height in the header covers both of them.
+func writeDIB(w io.Writer, img *image.NRGBA) error {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	maskStride := (width + 31) / 32 * 4
+	header := struct {
+		Size                   uint32
+		Width, Height          int32
+		Planes, BitCount       uint16
+		Compression, SizeImage uint32
+		XPelsPerMeter          int32
+		YPelsPerMeter          int32
+		ClrUsed, ClrImportant  uint32
+	}{
+		Size:      40,
+		Width:     int32(width),
+		Height:    int32(height * 2),
+		Planes:    1,
+		BitCount:  32,
+		SizeImage: uint32(width*height*4 + maskStride*height),
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	mask := make([]byte, maskStride*height)
+	for y := height - 1; y >= 0; y-- {
+		row := height - 1 - y
+		for x := 0; x < width; x++ {
+			c := img.NRGBAAt(x, y)
+			buf.Write([]byte{c.B, c.G, c.R, c.A})
+			if c.A == 0 {
+				mask[row*maskStride+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	buf.Write(mask)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// versionInfo builds the VS_VERSIONINFO resource from the profile metadata.
+func versionInfo(pkg pkgInfo, win windowsProfile) ([]byte, error) {
+	version, err := parseWinVersion(win.Version)
+	if err != nil {
+		return nil, err
+	}
+	ms := uint32(version[0])<<16 | uint32(version[1])
+	ls := uint32(version[2])<<16 | uint32(version[3])
+	fixed := []uint32{
+		0xfeef04bd, // signature
+		0x00010000, // struct version
+		ms, ls,     // file version
+		ms, ls, // product version
+		0x3f,       // flags mask
+		0,          // flags
+		0x00040004, // VOS_NT_WINDOWS32
+		0x1,        // VFT_APP
+		0, 0, 0,    // subtype, date
+	}
+	var fixedBuf bytes.Buffer
+	binary.Write(&fixedBuf, binary.LittleEndian, fixed)
+
+	versionStr := fmt.Sprintf("%d.%d.%d.%d", version[0], version[1], version[2], version[3])
+	product := win.ProductName
+	if len(product) < 1 {
+		product = pkg.Name
+	}
+	description := win.Description
+	if len(description) < 1 {
+		description = product
+	}
+	strs := map[string]string{
+		"CompanyName":      win.CompanyName,
+		"FileDescription":  description,
+		"FileVersion":      versionStr,
+		"InternalName":     pkg.Name,
+		"LegalCopyright":   win.Copyright,
+		"OriginalFilename": pkg.Name + ".exe",
+		"ProductName":      product,
+		"ProductVersion":   versionStr,
+	}
+	keys := make([]string, 0, len(strs))
+	for key, val := range strs {
+		if len(val) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var entries [][]byte
+	for _, key := range keys {
+		val := utf16z(strs[key])
+		entries = append(entries, versionBlock(key, 1, val, uint16(len(val)/2)))
+	}
+	table := versionBlock(fmt.Sprintf("%04x%04x", langEnUS, codepageUTF16), 1, nil, 0, entries...)
+	stringInfo := versionBlock("StringFileInfo", 1, nil, 0, table)
+
+	var translation bytes.Buffer
+	binary.Write(&translation, binary.LittleEndian, [2]uint16{langEnUS, codepageUTF16})
+	varInfo := versionBlock("VarFileInfo", 1, nil, 0,
+		versionBlock("Translation", 0, translation.Bytes(), uint16(translation.Len())))
+
+	return versionBlock("VS_VERSION_INFO", 0, fixedBuf.Bytes(), uint16(fixedBuf.Len()),
+		stringInfo, varInfo), nil
+}
+
+// versionBlock encodes one of the nested version info structures:
+//
+//     WORD wLength; WORD wValueLength; WORD wType; WCHAR szKey[];
+//     padding; value; padding; children
+//
+// valueLen is in bytes for binary values and in WORDs for strings, as the format wants.
+func versionBlock(key string, typ uint16, value []byte, valueLen uint16, children ...[]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, valueLen, typ})
+	buf.Write(utf16z(key))
+	pad4(&buf)
+	buf.Write(value)
+	for _, child := range children {
+		pad4(&buf)
+		buf.Write(child)
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data, uint16(len(data)))
+	return data
+}
+
+// parseWinVersion parses up to four dot-separated numbers, missing ones are zeroes.
+// Anything after the numeric part (i.e. -rc1 or +build) is ignored.
+func parseWinVersion(version string) (v [4]uint16, err error) {
+	version = strings.TrimPrefix(version, "v")
+	if idx := strings.IndexAny(version, "-+ "); idx >= 0 {
+		version = version[:idx]
+	}
+	if len(version) < 1 {
+		return
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > 4 {
+		return v, fmt.Errorf("windows: bad version: %s", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 16)
+		if err != nil {
+			return v, fmt.Errorf("windows: bad version: %s", version)
+		}
+		v[i] = uint16(n)
+	}
+	return
+}
+
+func utf16z(s string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, append(utf16.Encode([]rune(s)), 0))
+	return buf.Bytes()
+}
+
+func pad4(buf *bytes.Buffer) {
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// winManifest renders the application manifest.
+func winManifest(pkg pkgInfo, win windowsProfile) ([]byte, error) {
+	data := struct {
+		Name, Version, Description string
+		ExecutionLevel             string
+		CommonControls             bool
+		DPIAware, DPIAwareness     string
+	}{
+		Name:           bundleIdentifier(pkg.ImportPath),
+		Description:    win.Description,
+		ExecutionLevel: "asInvoker",
+		CommonControls: win.CommonControls == nil || *win.CommonControls,
+	}
+	version, err := parseWinVersion(win.Version)
+	if err != nil {
+		return nil, err
+	}
+	data.Version = fmt.Sprintf("%d.%d.%d.%d", version[0], version[1], version[2], version[3])
+	switch level := win.ExecutionLevel; level {
+	case "":
+	case "asInvoker", "highestAvailable", "requireAdministrator":
+		data.ExecutionLevel = level
+	default:
+		return nil, fmt.Errorf("windows: unknown execution level: %s", level)
+	}
+	switch strings.ToLower(win.DPIAwareness) {
+	case "none":
+	case "system":
+		data.DPIAware = "true"
+	case "permonitor":
+		data.DPIAware, data.DPIAwareness = "true/pm", "PerMonitor"
+	case "", "permonitorv2":
+		data.DPIAware, data.DPIAwareness = "true/pm", "PerMonitorV2, PerMonitor"
+	default:
+		return nil, fmt.Errorf("windows: unknown dpi awareness: %s", win.DPIAwareness)
+	}
+	tpl := template.Must(template.New("manifest").Funcs(template.FuncMap{
+		"xml": plistEscape,
+	}).Parse(winManifestTpl))
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// coffMachines maps GOARCH to the machine type of COFF header and
+// the type of the relocation against image base.
+var coffMachines = map[string][2]uint16{
+	"386":   {0x14c, 0x7},  // IMAGE_REL_I386_DIR32NB
+	"amd64": {0x8664, 0x3}, // IMAGE_REL_AMD64_ADDR32NB
+	"arm":   {0x1c4, 0x2},  // IMAGE_REL_ARM_ADDR32NB
+	"arm64": {0xaa64, 0x2}, // IMAGE_REL_ARM64_ADDR32NB
+}
+
+// writeCOFF writes res as a COFF object file with a single .rsrc section:
+//
+//     file header, section header
+//     resource directory: type -> id -> language -> data entry
+//     data entries and resource data
+//     relocations of data entries, symbol table, string table
+//
+// Data entries hold RVAs, so each of them is relocated against the .rsrc symbol.
+func writeCOFF(w io.Writer, goarch string, res winResources) error {
+	machine, ok := coffMachines[goarch]
+	if !ok {
+		return fmt.Errorf("windows: resources: unsupported arch: %s", goarch)
+	}
+	type resource struct {
+		typ, id uint32
+		data    []byte
+	}
+	var list []resource
+	for i, icon := range res.icons {
+		list = append(list, resource{rtIcon, uint32(i + 1), icon})
+	}
+	if len(res.group) > 0 {
+		list = append(list, resource{rtGroupIcon, 1, res.group})
+	}
+	if len(res.version) > 0 {
+		list = append(list, resource{rtVersion, 1, res.version})
+	}
+	if len(res.manifest) > 0 {
+		list = append(list, resource{rtManifest, 1, res.manifest})
+	}
+	var types []uint32
+	byType := make(map[uint32][]resource)
+	for _, r := range list {
+		if _, ok := byType[r.typ]; !ok {
+			types = append(types, r.typ)
+		}
+		byType[r.typ] = append(byType[r.typ], r)
+	}
+
+	// sizes of directory levels: root, one per type, one per resource
+	const dirSize, entrySize, dataEntrySize = 16, 8, 16
+	rootSize := dirSize + entrySize*len(types)
+	typesSize := 0
+	for _, typ := range types {
+		typesSize += dirSize + entrySize*len(byType[typ])
+	}
+	langsSize := len(list) * (dirSize + entrySize)
+	dataEntries := rootSize + typesSize + langsSize
+	dataStart := dataEntries + dataEntrySize*len(list)
+
+	var sect bytes.Buffer
+	le := binary.LittleEndian
+	writeDir := func(entries int) {
+		binary.Write(&sect, le, [4]uint32{0, 0, 0, uint32(entries) << 16})
+	}
+	const subdir = 0x80000000
+	// root: type entries
+	writeDir(len(types))
+	offset := rootSize
+	for _, typ := range types {
+		binary.Write(&sect, le, [2]uint32{typ, subdir | uint32(offset)})
+		offset += dirSize + entrySize*len(byType[typ])
+	}
+	// types: id entries
+	langOffset := rootSize + typesSize
+	for _, typ := range types {
+		writeDir(len(byType[typ]))
+		for _, r := range byType[typ] {
+			binary.Write(&sect, le, [2]uint32{r.id, subdir | uint32(langOffset)})
+			langOffset += dirSize + entrySize
+		}
+	}
+	// ids: language entries, in the same order as data entries follow
+	var ordered []resource
+	for _, typ := range types {
+		ordered = append(ordered, byType[typ]...)
+	}
+	for i := range ordered {
+		writeDir(1)
+		binary.Write(&sect, le, [2]uint32{langEnUS, uint32(dataEntries + i*dataEntrySize)})
+	}
+	// data entries
+	var relocs []uint32
+	dataOffset := dataStart
+	for _, r := range ordered {
+		relocs = append(relocs, uint32(sect.Len()))
+		binary.Write(&sect, le, [4]uint32{uint32(dataOffset), uint32(len(r.data)), 0, 0})
+		dataOffset += (len(r.data) + 7) &^ 7
+	}
+	// data
+	for _, r := range ordered {
+		sect.Write(r.data)
+		for sect.Len()%8 != 0 {
+			sect.WriteByte(0)
+		}
+	}
+
+	const fileHeaderSize, sectionHeaderSize, relocSize = 20, 40, 10
+	rawStart := fileHeaderSize + sectionHeaderSize
+	relocStart := rawStart + sect.Len()
+	symStart := relocStart + relocSize*len(relocs)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, le, struct {
+		Machine              uint16
+		NumberOfSections     uint16
+		TimeDateStamp        uint32
+		PointerToSymbolTable uint32
+		NumberOfSymbols      uint32
+		SizeOfOptionalHeader uint16
+		Characteristics      uint16
+	}{machine[0], 1, 0, uint32(symStart), 1, 0, 0})
+	binary.Write(&buf, le, struct {
+		Name                 [8]byte
+		VirtualSize          uint32
+		VirtualAddress       uint32
+		SizeOfRawData        uint32
+		PointerToRawData     uint32
+		PointerToRelocations uint32
+		PointerToLineNumbers uint32
+		NumberOfRelocations  uint16
+		NumberOfLineNumbers  uint16
+		Characteristics      uint32
+	}{
+		Name:                 [8]byte{'.', 'r', 's', 'r', 'c'},
+		SizeOfRawData:        uint32(sect.Len()),
+		PointerToRawData:     uint32(rawStart),
+		PointerToRelocations: uint32(relocStart),
+		NumberOfRelocations:  uint16(len(relocs)),
+		Characteristics:      0x40000040, // IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+	})
+	sect.WriteTo(&buf)
+	for _, addr := range relocs {
+		binary.Write(&buf, le, addr)
+		binary.Write(&buf, le, uint32(0)) // symbol .rsrc
+		binary.Write(&buf, le, machine[1])
+	}
+	// symbol table: .rsrc, static, section 1
+	buf.Write([]byte{'.', 'r', 's', 'r', 'c', 0, 0, 0})
+	binary.Write(&buf, le, uint32(0))
+	binary.Write(&buf, le, uint16(1))
+	binary.Write(&buf, le, uint16(0))
+	buf.Write([]byte{3, 0})
+	// empty string table
+	binary.Write(&buf, le, uint32(4))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+const winManifestTpl = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+	<assemblyIdentity type="win32" name="{{xml .Name}}" version="{{.Version}}" processorArchitecture="*"/>
+{{- if .Description}}
+	<description>{{xml .Description}}</description>
+{{- end}}
+{{- if .CommonControls}}
+	<dependency>
+		<dependentAssembly>
+			<assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0" processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+		</dependentAssembly>
+	</dependency>
+{{- end}}
+	<trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+		<security>
+			<requestedPrivileges>
+				<requestedExecutionLevel level="{{.ExecutionLevel}}" uiAccess="false"/>
+			</requestedPrivileges>
+		</security>
+	</trustInfo>
+	<compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+		<application>
+			<supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+			<supportedOS Id="{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"/>
+			<supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+			<supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+		</application>
+	</compatibility>
+{{- if .DPIAware}}
+	<application xmlns="urn:schemas-microsoft-com:asm.v3">
+		<windowsSettings>
+			<dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">{{.DPIAware}}</dpiAware>
+{{- if .DPIAwareness}}
+			<dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">{{.DPIAwareness}}</dpiAwareness>
+{{- end}}
+		</windowsSettings>
+	</application>
+{{- end}}
+</assembly>
+`
@@ -0,0 +1,297 @@
+// winres_test.go — tests of the windows resource writer, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package deploy
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var le = binary.LittleEndian
+
+// readResources walks the resource directory of the .rsrc section of a COFF
+// object, data entries hold offsets within the section since the object is
+// not linked yet. Resources are keyed by type and id.
+func readResources(t *testing.T, f *pe.File) map[[2]uint32][]byte {
+	t.Helper()
+	sect := f.Section(".rsrc")
+	if sect == nil {
+		t.Fatal("no .rsrc section")
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := func(off uint32) (list [][2]uint32) {
+		n := uint32(le.Uint16(data[off+12:])) + uint32(le.Uint16(data[off+14:]))
+		for i := uint32(0); i < n; i++ {
+			e := data[off+16+8*i:]
+			list = append(list, [2]uint32{le.Uint32(e), le.Uint32(e[4:])})
+		}
+		return
+	}
+	const subdir = 0x80000000
+	res := make(map[[2]uint32][]byte)
+	for _, typ := range entries(0) {
+		for _, id := range entries(typ[1] &^ subdir) {
+			langs := entries(id[1] &^ subdir)
+			if len(langs) != 1 || langs[0][0] != langEnUS || langs[0][1]&subdir != 0 {
+				t.Fatalf("type %d id %d: bad language entries %v", typ[0], id[0], langs)
+			}
+			entry := data[langs[0][1]:]
+			rva, size := le.Uint32(entry), le.Uint32(entry[4:])
+			res[[2]uint32{typ[0], id[0]}] = data[rva : rva+size]
+		}
+	}
+	return res
+}
+
+func TestWriteCOFF(t *testing.T) {
+	res := winResources{
+		icons:    [][]byte{[]byte("icon1"), []byte("icon 2, longer")},
+		group:    []byte("group"),
+		version:  []byte("version info"),
+		manifest: []byte("<assembly/>"),
+	}
+	want := map[[2]uint32][]byte{
+		{rtIcon, 1}:      res.icons[0],
+		{rtIcon, 2}:      res.icons[1],
+		{rtGroupIcon, 1}: res.group,
+		{rtVersion, 1}:   res.version,
+		{rtManifest, 1}:  res.manifest,
+	}
+	tests := []struct {
+		goarch  string
+		machine uint16
+		reloc   uint16
+	}{
+		{"386", pe.IMAGE_FILE_MACHINE_I386, 0x7},
+		{"amd64", pe.IMAGE_FILE_MACHINE_AMD64, 0x3},
+		{"arm", pe.IMAGE_FILE_MACHINE_ARMNT, 0x2},
+		{"arm64", pe.IMAGE_FILE_MACHINE_ARM64, 0x2},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeCOFF(&buf, tt.goarch, res); err != nil {
+			t.Fatalf("%s: %v", tt.goarch, err)
+		}
+		f, err := pe.NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.goarch, err)
+		}
+		if f.Machine != tt.machine {
+			t.Errorf("%s: machine %#x, want %#x", tt.goarch, f.Machine, tt.machine)
+		}
+		if len(f.Sections) != 1 || len(f.Symbols) != 1 || f.Symbols[0].Name != ".rsrc" {
+			t.Fatalf("%s: want a single .rsrc section and symbol", tt.goarch)
+		}
+		relocs := f.Sections[0].Relocs
+		if len(relocs) != len(want) {
+			t.Errorf("%s: %d relocations, want one per resource", tt.goarch, len(relocs))
+		}
+		for _, r := range relocs {
+			if r.Type != tt.reloc || r.SymbolTableIndex != 0 {
+				t.Errorf("%s: relocation %+v", tt.goarch, r)
+			}
+		}
+		got := readResources(t, f)
+		if len(got) != len(want) {
+			t.Errorf("%s: %d resources, want %d", tt.goarch, len(got), len(want))
+		}
+		for key, data := range want {
+			if !bytes.Equal(got[key], data) {
+				t.Errorf("%s: resource %v: got %q, want %q", tt.goarch, key, got[key], data)
+			}
+		}
+	}
+	if err := writeCOFF(new(bytes.Buffer), "mips", res); err == nil {
+		t.Error("mips: no error")
+	}
+}
+
+// verBlock is a decoded version info structure.
+type verBlock struct {
+	Key      string
+	Type     uint16
+	Value    []byte
+	Children []verBlock
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func parseVerBlock(t *testing.T, b []byte) verBlock {
+	t.Helper()
+	length, valueLen, typ := int(le.Uint16(b)), int(le.Uint16(b[2:])), le.Uint16(b[4:])
+	if length > len(b) {
+		t.Fatalf("block of %d bytes, %d left", length, len(b))
+	}
+	b = b[:length]
+	var key []uint16
+	off := 6
+	for ; le.Uint16(b[off:]) != 0; off += 2 {
+		key = append(key, le.Uint16(b[off:]))
+	}
+	off = align4(off + 2)
+	if typ == 1 {
+		valueLen *= 2
+	}
+	blk := verBlock{Key: string(utf16.Decode(key)), Type: typ, Value: b[off : off+valueLen]}
+	for off = align4(off + valueLen); off < length; {
+		child := parseVerBlock(t, b[off:])
+		blk.Children = append(blk.Children, child)
+		off = align4(off + int(le.Uint16(b[off:])))
+	}
+	return blk
+}
+
+func verString(value []byte) string {
+	var s []uint16
+	for i := 0; i+1 < len(value); i += 2 {
+		s = append(s, le.Uint16(value[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(s)), "\x00")
+}
+
+func TestVersionInfo(t *testing.T) {
+	pkg := pkgInfo{Name: "hello"}
+	tests := []struct {
+		name    string
+		win     windowsProfile
+		ms, ls  uint32
+		strings map[string]string
+		err     bool
+	}{
+		{
+			name: "full",
+			win: windowsProfile{
+				CompanyName: "Example Inc.",
+				Description: "Hello World",
+				Copyright:   "(c) 2014",
+				ProductName: "Hello",
+				Version:     "1.2.3.4",
+			},
+			ms: 0x00010002, ls: 0x00030004,
+			strings: map[string]string{
+				"CompanyName":      "Example Inc.",
+				"FileDescription":  "Hello World",
+				"FileVersion":      "1.2.3.4",
+				"InternalName":     "hello",
+				"LegalCopyright":   "(c) 2014",
+				"OriginalFilename": "hello.exe",
+				"ProductName":      "Hello",
+				"ProductVersion":   "1.2.3.4",
+			},
+		},
+		{
+			name: "defaults",
+			win:  windowsProfile{Version: "v2.1-rc1"},
+			ms:   0x00020001, ls: 0,
+			strings: map[string]string{
+				"FileDescription":  "hello",
+				"FileVersion":      "2.1.0.0",
+				"InternalName":     "hello",
+				"OriginalFilename": "hello.exe",
+				"ProductName":      "hello",
+				"ProductVersion":   "2.1.0.0",
+			},
+		},
+		{name: "too many parts", win: windowsProfile{Version: "1.2.3.4.5"}, err: true},
+		{name: "too large", win: windowsProfile{Version: "1.70000"}, err: true},
+	}
+	for _, tt := range tests {
+		buf, err := versionInfo(pkg, tt.win)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		root := parseVerBlock(t, buf)
+		if root.Key != "VS_VERSION_INFO" || len(root.Value) != 52 {
+			t.Fatalf("%s: root %q with %d bytes value", tt.name, root.Key, len(root.Value))
+		}
+		fixed := make([]uint32, 13)
+		binary.Read(bytes.NewReader(root.Value), le, fixed)
+		if fixed[0] != 0xfeef04bd {
+			t.Errorf("%s: signature %#x", tt.name, fixed[0])
+		}
+		if fixed[2] != tt.ms || fixed[3] != tt.ls || fixed[4] != tt.ms || fixed[5] != tt.ls {
+			t.Errorf("%s: versions %#x %#x %#x %#x, want %#x %#x", tt.name,
+				fixed[2], fixed[3], fixed[4], fixed[5], tt.ms, tt.ls)
+		}
+		if len(root.Children) != 2 || root.Children[0].Key != "StringFileInfo" || root.Children[1].Key != "VarFileInfo" {
+			t.Fatalf("%s: children %+v", tt.name, root.Children)
+		}
+		tables := root.Children[0].Children
+		if len(tables) != 1 || tables[0].Key != "040904b0" {
+			t.Fatalf("%s: string tables %+v", tt.name, tables)
+		}
+		got := make(map[string]string)
+		for _, s := range tables[0].Children {
+			got[s.Key] = verString(s.Value)
+		}
+		if len(got) != len(tt.strings) {
+			t.Errorf("%s: strings %v, want %v", tt.name, got, tt.strings)
+		}
+		for key, want := range tt.strings {
+			if got[key] != want {
+				t.Errorf("%s: %s is %q, want %q", tt.name, key, got[key], want)
+			}
+		}
+		vars := root.Children[1].Children
+		if len(vars) != 1 || vars[0].Key != "Translation" || !bytes.Equal(vars[0].Value, []byte{0x09, 0x04, 0xb0, 0x04}) {
+			t.Errorf("%s: translation %+v", tt.name, vars)
+		}
+	}
+}
+
+func TestBuildArch(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile map[string]string // build env of the profile
+		env     string            // $GOARCH
+		want    string
+	}{
+		{"profile", map[string]string{"GOARCH": "386"}, "arm64", "386"},
+		{"process env", nil, "arm64", "arm64"},
+		{"host", nil, "", runtime.GOARCH},
+	}
+	for _, tt := range tests {
+		t.Setenv("GOARCH", tt.env)
+		cfg := &config{Profile: deployProfile{Build: BuildOptions{Env: tt.profile}}}
+		if got := buildArch(cfg); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -29,9 +29,29 @@ using engine.AddImageProvider, but there is a problem with QML files so for now
 
 	.
 	├── README.md
+	├── cmd
+	│   └── qmlkit
+	│       ├── commands.go
+	│       ├── gen_help.go
+	│       ├── help.go
+	│       └── main.go
+	├── deploy
+	│   ├── deploy.go
+	│   ├── desktop.go
+	│   ├── doctor.go
+	│   ├── hook.go
+	│   ├── icon.go
+	│   ├── macho.go
+	│   ├── plist.go
+	│   ├── qtenv.go
+	│   ├── reproducible.go
+	│   ├── staging.go
+	│   ├── target.go
+	│   └── winres.go
 	├── deploy_profile.yaml
 	├── deploy_task.go
 	├── doc.go
+	├── doctor_task.go
 	├── main.go
 	├── project
 	│   ├── images
@@ -48,7 +68,8 @@ using engine.AddImageProvider, but there is a problem with QML files so for now
 	└── wizard_icon.png
 
 Parts of this template can be used independently, for example you may wish to add a deployment task to your already
-writen project — just copy deploy_task.go and deploy_profile.yaml files and run `gotask deploy`.
+writen project — just copy deploy_profile.yaml and *_task.go files and run `gotask deploy`. The tasks are thin
+wrappers around the gopkg.in/qml-kit.v0/deploy package, it can be imported by your own build tools as well.
 
 Installation
 
@@ -70,6 +91,13 @@ A general help for each task can be received using the help command:
 
 	gotask help <task>
 
+The same tasks are available without gotask from the qmlkit command, e.g. `qmlkit deploy -v` or `qmlkit help deploy`,
+verify is an alias of doctor. It works on the same deploy_profile.yaml and project layout and exits with 1 if a task
+fails, 2 on wrong usage. Options and help of qmlkit are generated from doc comments of the *_task.go files, run
+`go generate ./cmd/qmlkit` after changing them.
+
+	go install gopkg.in/qml-kit.v0/cmd/qmlkit
+
 Examples of tasks:
 
 	gotask clean
@@ -77,16 +105,49 @@ Examples of tasks:
 Runs `rice clean` to remove leftovers from resource embedding, purges wizard configs if any left in project dir.
 The doc.go file is being removed too, since it is not related to your aplication at all.
 
+	gotask doctor
+
+Checks that go, qmake, qtpaths, pkg-config, rice and the OS X tools are in place and refer to the same Qt install,
+and that every lib, plugin and module listed in deploy_profile.yaml exists. Run it first if deployment fails.
+
 	gotask deploy -v
 
-Runs deployment with verbosive output. You may use the --dmg option if you're running OS X. Make sure that all
+Runs deployment with verbosive output. You may use the --dmg option if you're running OS X, --universal builds
+a single binary for both Intel and Apple Silicon Macs (the Qt in use must be universal too). Make sure that all
 of the used modules and libs are correctly listed in the deploy_profile.yaml manifest before you run deployment task.
 
+	gotask deploy ./cmd/helper
+
+Deploys another main package of the module, an import path or a dir may be given as well. Its project/ assets
+are looked up from the package dir up to the module root, vendored dependencies are used if the module has them.
+Several executables sharing the bundled Qt, e.g. a crash reporter next to the app, can be listed in the binaries
+section of deploy_profile.yaml, each of them is built and relinked into the package.
+
+The package is deployed into a staging dir, i.e. out/.darwin.staging, and replaces the previous one only when
+deployment succeeds, so a failed or interrupted deploy leaves the last good package in place. Pass --keep-failed
+to keep the staging dir for debugging. A lock file next to the output dir stops two deploys into it at once.
+
+Deployment is reproducible: files are generated and copied in a stable order, binaries are built with -trimpath
+and an empty build id, and the build date stamped into them and generated metadata as well as mtimes of the package
+files come from $SOURCE_DATE_EPOCH or the time of the last commit. Run `gotask deploy --check` to deploy twice
+and compare the results, disk images are left out since hdiutil puts random ids into them.
+
+Code signing, asset generation and the like can be attached to stages of deployment with hooks, see the hooks
+section of deploy_profile.yaml.
+
+	gotask deploy --target=embedded
+
+Deploys for a target other than the current platform's default one. A target is a Deployer (see deploy/target.go)
+registered with deploy.RegisterTarget from your own *_task.go file, embed deploy.BaseDeployer and override the stages
+(layout, build, libs, plugins, modules, finalize) that differ.
+
 Notes
 
-This implementation uses qmake and qtpaths in order to detect the paths Qt is installed, so make sure you've set
-$PATH env variable correctly so these binaries are related to Qt distribution you're linking against. It's easy to check by comparing
-outputs from `qmake -v` and `pkg-config --cflags`.
+This implementation uses `qmake -query` in order to detect the paths Qt is installed, so make sure you've set
+$PATH env variable correctly so qmake is related to Qt distribution you want to ship. Another Qt can be chosen by setting
+$QMLKIT_QMAKE to the path of its qmake or $QMLKIT_QT_DIR to its prefix, the same can be done with qmake and qtdir keys
+of the deploy_profile.yaml. The deploy task points PKG_CONFIG_PATH, CGO_CXXFLAGS and CGO_LDFLAGS of `go build` to that Qt
+and checks the QtCore the binary is linked against afterwards, so a mismatch is reported rather than shipped.
 
 Another important thing is that the Qt libs shipped with ubuntu are not suitable for deploying since libqxcb.so platform
 contains too many linked libs. Compare these ldd outputs: http://pastebin.com/nVeg2eGQ (5.2.1+dfsg-1ubuntu14.2)
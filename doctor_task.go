@@ -0,0 +1,62 @@
+// v0 // THIS FILE MAY BE OVERWRITTEN BY UPDATE
+// doctor_task.go — checks of the tools and Qt the deployment relies on, part of the go-qml-kit.
+//
+// Authors:
+//     Maxim Kouprianov <max@kc.vc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the “Software”), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build gotask
+
+package main
+
+import (
+	"os"
+
+	"github.com/jingweno/gotask/tasking"
+	"gopkg.in/qml-kit.v0/deploy"
+)
+
+// NAME
+//	doctor - Check the tools and Qt used by deployment
+//
+// DESCRIPTION
+// 	Looks for every external tool the deploy task runs, reports their versions,
+//  makes sure qmake, qtpaths and pkg-config refer to the same Qt install and that
+//	each lib, plugin and module listed in the profile exists in it.
+//	Prints a pass/warn/fail table with a suggested fix for each problem.
+//	An optional argument selects the main package like the deploy task does.
+//
+// OPTIONS
+//	--verbose, -v
+//		Print the commands being run
+//	--target=<name>
+//		Target the profile entries are checked for, the current platform by default
+func TaskDoctor(t *tasking.T) {
+	cfg, err := deploy.FlagConfig(t.Flags, t.Args)
+	if err != nil {
+		t.Fatalf("doctor: %v", err)
+	}
+	if t.Flags.Bool("verbose") {
+		cfg.Events = func(e deploy.Event) { t.Log(e) }
+	}
+	if failed := deploy.WriteReport(os.Stdout, deploy.Doctor(cfg)); failed > 0 {
+		t.Fatalf("doctor: %d check(s) failed\n", failed)
+	}
+}
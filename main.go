@@ -13,6 +13,13 @@ import (
 	"gopkg.in/qml.v1"
 )
 
+// Release info, stamped by the deploy task via -ldflags -X.
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
 var imageEmpty = image.NewRGBA(image.Rect(0, 0, 16, 16))
 var boxImages *rice.Box
 var boxQml *rice.Box
@@ -31,6 +38,7 @@ func run() error {
 	engine := qml.NewEngine()
 
 	engine.AddImageProvider("images", unboxImage)
+	engine.Context().SetVar("appVersion", version)
 
 	engine.On("quit", func() {
 		fmt.Println("qml quit")